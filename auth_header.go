@@ -1,6 +1,12 @@
 package builder
 
-import "encoding/base64"
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+
+	"github.com/phuc1998/http-builder/structs"
+)
 
 type authorizationType string
 
@@ -45,3 +51,38 @@ func basicAuth(username, password string) string {
 	auth := username + ":" + password
 	return base64.StdEncoding.EncodeToString([]byte(auth))
 }
+
+// buildAuth sets the authorization headers of the fields tagged with an auth option:
+// "bearer" (the default of "authorizationType"), "basic" with a BasicAuth or a "user:password"
+// value, and "apikey=<Header-Name>", the header defaulting to the name of the field.
+func (b *builder) buildAuth(authMap map[string]interface{}) {
+	for name, value := range authMap {
+		param := value.(structs.Param)
+		if param.Value == nil || reflect.ValueOf(param.Value).IsZero() {
+			continue
+		}
+
+		if header, ok := param.Options.Value("apikey"); ok {
+			if header == "" {
+				header = name
+			}
+			b.SetAPIKeyHeader(APIKey{Key: header, Value: parameterToString(param.Value, "")})
+			continue
+		}
+
+		if param.Options.Has("basic") {
+			switch credential := param.Value.(type) {
+			case BasicAuth:
+				b.SetBasicAuthHeader(credential)
+			case *BasicAuth:
+				b.SetBasicAuthHeader(*credential)
+			default:
+				userName, password, _ := strings.Cut(parameterToString(credential, ""), ":")
+				b.SetBasicAuthHeader(BasicAuth{UserName: userName, Password: password})
+			}
+			continue
+		}
+
+		b.SetBearerHeader(parameterToString(param.Value, ""))
+	}
+}
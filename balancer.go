@@ -0,0 +1,228 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// BalancePolicy tells how a LoadBalancer picks the server of a call.
+type BalancePolicy int
+
+const (
+	// RoundRobin picks the servers in turn.
+	RoundRobin BalancePolicy = iota
+	// Random picks a server at random.
+	Random
+	// LeastInFlight picks the server with the fewest calls in progress.
+	LeastInFlight
+	// Failover picks the first healthy server in the order of Servers, the others are secondaries.
+	Failover
+)
+
+// LoadBalancer spreads the calls of the builders that do not choose a server across the
+// Servers of the configuration. A server is marked unhealthy after FailureThreshold
+// consecutive failures and skipped until Cooldown has passed, then a single call probes it
+// again. Each attempt of a retried call picks a server, preferring the ones not tried yet.
+type LoadBalancer struct {
+	// Policy picks the server of a call among the healthy ones.
+	Policy BalancePolicy
+	// FailureThreshold is the number of consecutive failures marking a server unhealthy (default 3).
+	FailureThreshold int
+	// Cooldown is how long an unhealthy server is skipped before it is probed again (default 30s).
+	Cooldown time.Duration
+	// IsFailure reports whether the outcome of a call counts as a failure of the server.
+	// When nil transport errors, except cancellation, and 5xx responses are failures.
+	IsFailure func(resp *http.Response, err error) bool
+
+	mu      sync.Mutex
+	next    int
+	servers map[string]*serverHealth
+}
+
+// serverHealth tracks the calls to a server.
+type serverHealth struct {
+	inFlight  int
+	failures  int
+	unhealthy bool
+	retryAt   time.Time
+	probing   bool
+}
+
+// NewLoadBalancer returns a load balancer with the given policy and the default thresholds.
+func NewLoadBalancer(policy BalancePolicy) *LoadBalancer {
+	return &LoadBalancer{
+		Policy:           policy,
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// Healthy reports whether a server, given by its resolved URL, takes calls.
+func (lb *LoadBalancer) Healthy(server string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return !lb.health(server).unhealthy
+}
+
+func (lb *LoadBalancer) health(server string) *serverHealth {
+	if lb.servers == nil {
+		lb.servers = make(map[string]*serverHealth)
+	}
+	h, ok := lb.servers[server]
+	if !ok {
+		h = &serverHealth{}
+		lb.servers[server] = h
+	}
+	return h
+}
+
+// pick returns the server of an attempt and counts it in flight. Servers already tried by the
+// call are avoided when another one is available. When every server is unhealthy, the one
+// probed again the soonest is returned.
+func (lb *LoadBalancer) pick(servers []string, tried map[string]bool) string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := time.Now()
+	var available, untried []string
+	for _, server := range servers {
+		h := lb.health(server)
+		if h.unhealthy && (h.probing || now.Before(h.retryAt)) {
+			continue
+		}
+		available = append(available, server)
+		if !tried[server] {
+			untried = append(untried, server)
+		}
+	}
+	if len(untried) > 0 {
+		available = untried
+	}
+
+	var server string
+	switch {
+	case len(available) == 0:
+		server = servers[0]
+		for _, s := range servers[1:] {
+			if lb.health(s).retryAt.Before(lb.health(server).retryAt) {
+				server = s
+			}
+		}
+	case lb.Policy == Random:
+		server = available[rand.Intn(len(available))]
+	case lb.Policy == LeastInFlight:
+		server = available[0]
+		for _, s := range available[1:] {
+			if lb.health(s).inFlight < lb.health(server).inFlight {
+				server = s
+			}
+		}
+	case lb.Policy == Failover:
+		server = available[0]
+	default:
+		server = available[lb.next%len(available)]
+		lb.next++
+	}
+
+	h := lb.health(server)
+	h.inFlight++
+	if h.unhealthy {
+		h.probing = true
+	}
+	return server
+}
+
+// done records the outcome of an attempt to a server. It returns true when the server
+// becomes unhealthy or healthy again.
+func (lb *LoadBalancer) done(server string, resp *http.Response, err error) (changed bool) {
+	failed := (err != nil && !errors.Is(err, context.Canceled)) || (resp != nil && resp.StatusCode >= 500)
+	if lb.IsFailure != nil {
+		failed = lb.IsFailure(resp, err)
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	h := lb.health(server)
+	h.inFlight--
+	h.probing = false
+	if !failed {
+		changed = h.unhealthy
+		h.failures, h.unhealthy = 0, false
+		return changed
+	}
+
+	h.failures++
+	threshold := lb.FailureThreshold
+	if threshold < 1 {
+		threshold = 1
+	}
+	if h.failures >= threshold {
+		changed = !h.unhealthy
+		h.unhealthy = true
+		h.retryAt = time.Now().Add(lb.cooldown())
+	}
+	return changed
+}
+
+// cooldown returns how long an unhealthy server is skipped.
+func (lb *LoadBalancer) cooldown() time.Duration {
+	if lb.Cooldown <= 0 {
+		return 30 * time.Second
+	}
+	return lb.Cooldown
+}
+
+// release forgets an attempt to a server that was not sent.
+func (lb *LoadBalancer) release(server string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	h := lb.health(server)
+	h.inFlight--
+	h.probing = false
+}
+
+// without returns the servers that are not excluded.
+func without(servers []string, excluded map[string]bool) []string {
+	if len(excluded) == 0 {
+		return servers
+	}
+	var kept []string
+	for _, server := range servers {
+		if !excluded[server] {
+			kept = append(kept, server)
+		}
+	}
+	return kept
+}
+
+// balancedTarget is what send needs to move each attempt of a request to the server picked
+// by the load balancer.
+type balancedTarget struct {
+	// servers are the resolved URLs of the servers to pick from.
+	servers []string
+	// path is the expanded uri of the builder.
+	path string
+	// query holds the query parameters of the builder.
+	query url.Values
+}
+
+// apply moves the request to the server, building its URL as prepareRequest does.
+func (t *balancedTarget) apply(c *APIClient, req *http.Request, server string) error {
+	resolved, err := resolveURL(server, t.path)
+	if err != nil {
+		return err
+	}
+	u, err := c.buildURL(resolved, t.query)
+	if err != nil {
+		return err
+	}
+	req.URL, req.Host = u, u.Host
+	return nil
+}
@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancerFailover(t *testing.T) {
+	var primaryHits, secondaryHits int
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits++
+		if r.URL.Path != "/v1/booking" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer secondary.Close()
+
+	balancer := NewLoadBalancer(Failover)
+	balancer.FailureThreshold = 1
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	cfg := NewConfiguration().AddRetryPolicy(policy).AddLoadBalancer(balancer)
+	cfg.Servers = []ServerConfiguration{{Url: primary.URL + "/v1"}, {Url: secondary.URL + "/v1"}}
+	apiClient := NewAPIClient(cfg)
+
+	for i := 0; i < 3; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if primaryHits != 1 || secondaryHits != 3 {
+		t.Errorf("unexpected hits, primary %d, secondary %d", primaryHits, secondaryHits)
+	}
+	if balancer.Healthy(primary.URL+"/v1") || !balancer.Healthy(secondary.URL+"/v1") {
+		t.Errorf("unexpected health")
+	}
+
+	// The primary is probed again after the cooldown
+	balancer.servers[primary.URL+"/v1"].retryAt = time.Now()
+	if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if primaryHits != 2 || secondaryHits != 4 {
+		t.Errorf("unexpected hits after cooldown, primary %d, secondary %d", primaryHits, secondaryHits)
+	}
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	var hits [2]int
+	servers := make([]ServerConfiguration, len(hits))
+	for i := range hits {
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+		}))
+		defer server.Close()
+		servers[i] = ServerConfiguration{Url: server.URL}
+	}
+
+	cfg := NewConfiguration().AddLoadBalancer(NewLoadBalancer(RoundRobin))
+	cfg.Servers = servers
+	apiClient := NewAPIClient(cfg)
+
+	for i := 0; i < 4; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A chosen server is not balanced
+	if _, err := apiClient.Builder("/booking").UseServer(0).Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if hits[0] != 3 || hits[1] != 2 {
+		t.Errorf("unexpected hits %v", hits)
+	}
+}
+
+func TestLoadBalancerAddServer(t *testing.T) {
+	var hits [2][]string
+	servers := make([]*httptest.Server, len(hits))
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i] = append(hits[i], r.URL.RequestURI())
+		}))
+		defer servers[i].Close()
+	}
+
+	cfg := NewConfiguration().
+		AddServer(ServerConfiguration{Url: servers[0].URL + "/v1?region=sg"}).
+		AddServer(ServerConfiguration{Url: servers[1].URL + "/v1?region=ie"}).
+		AddLoadBalancer(NewLoadBalancer(RoundRobin))
+	apiClient := NewAPIClient(cfg)
+
+	for i := 0; i < 4; i++ {
+		if _, err := apiClient.Builder("/booking").SetQuery("page", i).Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "[[/v1/booking?page=0&region=sg /v1/booking?page=2&region=sg] [/v1/booking?page=1&region=ie /v1/booking?page=3&region=ie]]"
+	if fmt.Sprint(hits) != expected {
+		t.Errorf("unexpected hits %v", hits)
+	}
+
+	// The host override of the configuration applies to every server
+	hits[0], hits[1] = nil, nil
+	cfg.Host = strings.TrimPrefix(servers[1].URL, "http://")
+	for i := 0; i < 2; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(hits[0]) != 0 || len(hits[1]) != 2 {
+		t.Errorf("unexpected hits with a host override %v", hits)
+	}
+}
+
+func TestLoadBalancerBasePath(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	// Without servers of its own, the balancer leaves the base path alone
+	cfg := NewConfiguration().AddBasePath(server.URL).AddLoadBalancer(NewLoadBalancer(RoundRobin))
+	apiClient := NewAPIClient(cfg)
+	if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 1 {
+		t.Errorf("unexpected hits %d", hits)
+	}
+}
@@ -0,0 +1,194 @@
+package builder
+
+import (
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// isStreamable reports whether a body can be sent without buffering it.
+func isStreamable(body interface{}) bool {
+	switch body.(type) {
+	case io.Reader, func() (io.ReadCloser, error):
+		return true
+	}
+	return false
+}
+
+// streamReader returns a body to pass through as is, along with a function replaying it
+// when the body can be replayed.
+func streamReader(body interface{}) (io.Reader, func() (io.ReadCloser, error), error) {
+	if open, ok := body.(func() (io.ReadCloser, error)); ok {
+		reader, err := open()
+		return reader, open, err
+	}
+
+	reader := body.(io.Reader)
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return reader, nil, nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return reader, nil, nil
+	}
+
+	var (
+		mu      sync.Mutex
+		current = &replayReader{reader: reader}
+	)
+	getBody := func() (io.ReadCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The transport may still be reading the body of the previous attempt
+		current.Close()
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		current = &replayReader{reader: reader}
+		return current, nil
+	}
+	return current, getBody, nil
+}
+
+// replayReader is the body of an attempt reading a shared reader. Once closed it no longer
+// reads the shared reader, which can then be rewound for the next attempt.
+type replayReader struct {
+	mu     sync.Mutex
+	reader io.Reader
+	closed bool
+}
+
+func (r *replayReader) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return r.reader.Read(b)
+}
+
+// Close waits for the read in progress, if any.
+func (r *replayReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// readerLen returns the number of bytes left in a reader, -1 when it is unknown.
+func readerLen(reader io.Reader) int64 {
+	switch r := reader.(type) {
+	case *replayReader:
+		return readerLen(r.reader)
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	}
+	return -1
+}
+
+// writeMultipart writes the form parameters and the parts into a multipart writer.
+// A form key prefixed with @ is a path of a file read from disk.
+func writeMultipart(w *multipart.Writer, formParams url.Values, parts []formPart) error {
+	for k, v := range formParams {
+		for _, iv := range v {
+			if strings.HasPrefix(k, "@") { // file
+				if err := addFile(w, k[1:], iv); err != nil {
+					return err
+				}
+			} else { // form value
+				if err := w.WriteField(k, iv); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for i := range parts {
+		if err := parts[i].write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamMultipart returns a function opening a multipart body written through a pipe
+// while it is read, so that files are never held in memory. The body can be opened
+// again, to be replayed, only when every part can be rewound.
+func streamMultipart(boundary string, formParams url.Values, parts []formPart) (func() (io.ReadCloser, error), bool) {
+	replayable := true
+	for i := range parts {
+		replayable = replayable && parts[i].rewindable()
+	}
+
+	var (
+		mu   sync.Mutex
+		last *pipeBody
+	)
+	openBody := func() (io.ReadCloser, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The transport does not wait for the body of the previous attempt to be written
+		// when the server replies early: stop its writer before rewinding the parts.
+		if last != nil {
+			last.stop()
+		}
+		for i := range parts {
+			if err := parts[i].rewind(); err != nil {
+				return nil, err
+			}
+		}
+		pr, pw := io.Pipe()
+		last = &pipeBody{PipeReader: pr, done: make(chan struct{}), write: func() {
+			w := multipart.NewWriter(pw)
+			err := w.SetBoundary(boundary)
+			if err == nil {
+				err = writeMultipart(w, formParams, parts)
+			}
+			if err == nil {
+				err = w.Close()
+			}
+			pw.CloseWithError(err)
+		}}
+		return last, nil
+	}
+	return openBody, replayable
+}
+
+// pipeBody starts writing into its pipe on the first read, so that nothing is left
+// blocked on the pipe when the body is never read.
+type pipeBody struct {
+	*io.PipeReader
+	once  sync.Once
+	write func()
+	done  chan struct{}
+}
+
+func (p *pipeBody) Read(b []byte) (int, error) {
+	p.once.Do(func() {
+		go func() {
+			defer close(p.done)
+			p.write()
+		}()
+	})
+	return p.PipeReader.Read(b)
+}
+
+// stop closes the pipe and waits for the writer to return, if it was started.
+func (p *pipeBody) stop() {
+	p.PipeReader.Close()
+	p.once.Do(func() { close(p.done) })
+	<-p.done
+}
@@ -0,0 +1,284 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched with errors.Is by the error of a call refused by an open circuit.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is returned by a call refused by an open circuit, without sending anything.
+type CircuitOpenError struct {
+	// Key is the host or the route of the circuit.
+	Key string
+	// Until is when the circuit lets a call through again.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s until %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+// Is matches ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of a circuit.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through and counts the failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen refuses every call until OpenDuration has passed.
+	CircuitOpen
+	// CircuitHalfOpen lets HalfOpenRequests calls through to probe the downstream service.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker keeps a circuit per host, or per route of the builders. A closed circuit opens
+// when the failure rate of the calls over Window reaches FailureRate, once MinRequests calls were
+// made. An open circuit refuses the calls with a CircuitOpenError for OpenDuration, then turns
+// half-open and lets HalfOpenRequests calls through: it closes when they all succeed and opens
+// again on the first failure.
+type CircuitBreaker struct {
+	// KeyByRoute keeps a circuit per uri template of the builders, such as "/booking/:id",
+	// instead of a circuit per host.
+	KeyByRoute bool
+	// FailureRate is the ratio of failed calls, between 0 and 1, opening the circuit (default 0.5).
+	FailureRate float64
+	// MinRequests is the number of calls over Window before the failure rate is checked (default 10).
+	MinRequests int
+	// Window is the period over which the calls are counted (default 1m).
+	Window time.Duration
+	// OpenDuration is how long an open circuit refuses the calls (default 30s).
+	OpenDuration time.Duration
+	// HalfOpenRequests is the number of calls probing a half-open circuit (default 1).
+	HalfOpenRequests int
+	// IsFailure reports whether the outcome of a call counts as a failure.
+	// When nil transport errors, except cancellation, and 5xx responses are failures.
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called when a circuit changes state. The change is also logged.
+	OnStateChange func(key string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit counts the calls of a host or a route.
+type circuit struct {
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// circuitChange is a change of state of a circuit.
+type circuitChange struct {
+	key      string
+	from, to CircuitState
+}
+
+// NewCircuitBreaker returns a circuit breaker with the default thresholds, keyed by host.
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureRate:      0.5,
+		MinRequests:      10,
+		Window:           time.Minute,
+		OpenDuration:     30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// State returns the state of the circuit of a host or a route.
+func (cb *CircuitBreaker) State(key string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.circuit(key).state
+}
+
+func (cb *CircuitBreaker) circuit(key string) *circuit {
+	if cb.circuits == nil {
+		cb.circuits = make(map[string]*circuit)
+	}
+	c, ok := cb.circuits[key]
+	if !ok {
+		c = &circuit{windowStart: time.Now()}
+		cb.circuits[key] = c
+	}
+	return c
+}
+
+// key returns the key of the circuit of a request.
+func (cb *CircuitBreaker) key(req *http.Request, route string) string {
+	if cb.KeyByRoute {
+		return route
+	}
+	return req.URL.Host
+}
+
+// halfOpenRequests returns the number of probing calls.
+func (cb *CircuitBreaker) halfOpenRequests() int {
+	if cb.HalfOpenRequests < 1 {
+		return 1
+	}
+	return cb.HalfOpenRequests
+}
+
+// failureRate returns the ratio of failed calls opening the circuit.
+func (cb *CircuitBreaker) failureRate() float64 {
+	if cb.FailureRate <= 0 {
+		return 0.5
+	}
+	return cb.FailureRate
+}
+
+// minRequests returns the number of calls before the failure rate is checked.
+func (cb *CircuitBreaker) minRequests() int {
+	if cb.MinRequests < 1 {
+		return 10
+	}
+	return cb.MinRequests
+}
+
+// window returns the period over which the calls are counted.
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.Window <= 0 {
+		return time.Minute
+	}
+	return cb.Window
+}
+
+// openDuration returns how long an open circuit refuses the calls.
+func (cb *CircuitBreaker) openDuration() time.Duration {
+	if cb.OpenDuration <= 0 {
+		return 30 * time.Second
+	}
+	return cb.OpenDuration
+}
+
+// setState changes the state of a circuit and resets its counts.
+func (c *circuit) setState(key string, state CircuitState, now time.Time) *circuitChange {
+	change := &circuitChange{key: key, from: c.state, to: state}
+	c.state = state
+	c.windowStart, c.requests, c.failures = now, 0, 0
+	c.probes, c.successes = 0, 0
+	if state == CircuitOpen {
+		c.openedAt = now
+	}
+	return change
+}
+
+// allow returns a CircuitOpenError if the circuit refuses the call, along with the change
+// of state of the circuit if any.
+func (cb *CircuitBreaker) allow(key string) (*circuitChange, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	var (
+		c      = cb.circuit(key)
+		now    = time.Now()
+		change *circuitChange
+	)
+	if c.state == CircuitOpen {
+		until := c.openedAt.Add(cb.openDuration())
+		if now.Before(until) {
+			return nil, &CircuitOpenError{Key: key, Until: until}
+		}
+		change = c.setState(key, CircuitHalfOpen, now)
+	}
+	if c.state == CircuitHalfOpen {
+		if c.probes >= cb.halfOpenRequests() {
+			return change, &CircuitOpenError{Key: key, Until: now}
+		}
+		c.probes++
+	}
+	return change, nil
+}
+
+// release forgets a call let through but not sent.
+func (cb *CircuitBreaker) release(key string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if c := cb.circuit(key); c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// record counts the outcome of a call and returns the change of state of the circuit if any.
+func (cb *CircuitBreaker) record(key string, resp *http.Response, err error) *circuitChange {
+	if errors.Is(err, context.Canceled) {
+		cb.release(key)
+		return nil
+	}
+	failed := err != nil || (resp != nil && resp.StatusCode >= 500)
+	if cb.IsFailure != nil {
+		failed = cb.IsFailure(resp, err)
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	c, now := cb.circuit(key), time.Now()
+	switch c.state {
+	case CircuitHalfOpen:
+		if failed {
+			return c.setState(key, CircuitOpen, now)
+		}
+		c.successes++
+		if c.successes >= cb.halfOpenRequests() {
+			return c.setState(key, CircuitClosed, now)
+		}
+	case CircuitClosed:
+		if now.Sub(c.windowStart) > cb.window() {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.failures > 0 && c.requests >= cb.minRequests() && float64(c.failures) >= cb.failureRate()*float64(c.requests) {
+			return c.setState(key, CircuitOpen, now)
+		}
+	}
+	return nil
+}
+
+// circuitChanged logs a change of state of a circuit and calls the OnStateChange callback.
+func (c *APIClient) circuitChanged(ctx context.Context, cb *CircuitBreaker, change *circuitChange) {
+	if change == nil {
+		return
+	}
+	level := LogLevelInfo
+	if change.to == CircuitOpen {
+		level = LogLevelWarn
+	}
+	c.log(ctx, level, "circuit state changed",
+		LogField{Key: "circuit", Value: change.key},
+		LogField{Key: "from", Value: change.from.String()},
+		LogField{Key: "to", Value: change.to.String()})
+	if cb.OnStateChange != nil {
+		cb.OnStateChange(change.key, change.from, change.to)
+	}
+}
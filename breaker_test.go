@@ -0,0 +1,154 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		hits    int
+		healthy bool
+		changes []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if !healthy {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	breaker := NewCircuitBreaker()
+	breaker.MinRequests = 2
+	breaker.OpenDuration = time.Hour
+	breaker.OnStateChange = func(key string, from, to CircuitState) {
+		changes = append(changes, from.String()+">"+to.String())
+	}
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddCircuitBreaker(breaker))
+
+	for i := 0; i < 3; i++ {
+		apiClient.Builder("/booking").Call(context.Background(), nil)
+	}
+	_, err := apiClient.Builder("/booking").Call(context.Background(), nil)
+
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) {
+		t.Fatalf("expected an open circuit, got %v", err)
+	}
+	if hits != 2 || breaker.State(openErr.Key) != CircuitOpen {
+		t.Errorf("unexpected %d hits in state %s", hits, breaker.State(openErr.Key))
+	}
+
+	// After OpenDuration a probe closes the circuit
+	healthy = true
+	breaker.circuits[openErr.Key].openedAt = time.Now().Add(-time.Hour)
+	if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if breaker.State(openErr.Key) != CircuitClosed {
+		t.Errorf("unexpected state %s", breaker.State(openErr.Key))
+	}
+
+	expected := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("unexpected changes %v", changes)
+		}
+	}
+}
+
+func TestCircuitBreakerByRoute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	breaker := NewCircuitBreaker()
+	breaker.KeyByRoute = true
+	breaker.MinRequests = 1
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddCircuitBreaker(breaker))
+
+	apiClient.Builder("/booking/:id").SetPath("id", 1).Call(context.Background(), nil)
+	_, err := apiClient.Builder("/booking/:id").SetPath("id", 2).Call(context.Background(), nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected an open circuit, got %v", err)
+	}
+	if _, err := apiClient.Builder("/health").Call(context.Background(), nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCircuitBreakerBalanced(t *testing.T) {
+	var hits [2]int
+	cfg := NewConfiguration()
+	for i := range hits {
+		i := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i]++
+			if i == 0 {
+				w.WriteHeader(http.StatusBadGateway)
+			}
+		}))
+		defer server.Close()
+		cfg.AddServer(ServerConfiguration{Url: server.URL})
+	}
+
+	breaker := NewCircuitBreaker()
+	breaker.MinRequests = 1
+	breaker.OpenDuration = time.Hour
+	balancer := NewLoadBalancer(RoundRobin)
+	balancer.FailureThreshold = 100
+	apiClient := NewAPIClient(cfg.AddCircuitBreaker(breaker).AddLoadBalancer(balancer))
+
+	// The first call opens the circuit of the first server, the others go to the second one
+	apiClient.Builder("/booking").Call(context.Background(), nil)
+	for i := 0; i < 4; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hits[0] != 1 || hits[1] != 4 {
+		t.Errorf("unexpected hits %v", hits)
+	}
+
+	// Without any server left the call fails fast
+	breaker.KeyByRoute = true
+	breaker.circuits["/booking"] = &circuit{state: CircuitOpen, openedAt: time.Now()}
+	_, err := apiClient.Builder("/booking").Call(context.Background(), nil)
+	if !errors.Is(err, ErrCircuitOpen) || hits[0]+hits[1] != 5 {
+		t.Errorf("expected an open circuit, got %v after %v", err, hits)
+	}
+}
+
+func TestCircuitBreakerDefaults(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// A breaker built without NewCircuitBreaker waits for MinRequests calls before opening
+	breaker := &CircuitBreaker{}
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddCircuitBreaker(breaker))
+
+	for i := 0; i < 10; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("circuit open after %d calls", i)
+		}
+	}
+	_, err := apiClient.Builder("/booking").Call(context.Background(), nil)
+	if !errors.Is(err, ErrCircuitOpen) || hits != 10 {
+		t.Errorf("expected an open circuit after 10 calls, got %v with %d hits", err, hits)
+	}
+}
@@ -1,10 +1,20 @@
 package builder
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type CommonResult struct {
@@ -131,3 +141,823 @@ func TestGet(t *testing.T) {
 	fmt.Printf("response %v\n", response)
 	t.Logf("response %v\n", response)
 }
+
+func TestInterceptors(t *testing.T) {
+	var (
+		response = PostResponse{}
+		order    []string
+		seenBody string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"statusCode":200,"message":"` + r.Header.Get("X-Tenant") + `"}`))
+	}))
+	defer server.Close()
+
+	cfg := NewConfiguration().
+		AddBasePath(server.URL).
+		AddRequestInterceptor(func(r *http.Request) error {
+			order = append(order, "config")
+			r.Header.Set("X-Tenant", "config")
+			return nil
+		}).
+		AddResponseInterceptor(func(resp *http.Response, body []byte) error {
+			seenBody = string(body)
+			return nil
+		})
+
+	apiClient := NewAPIClient(cfg)
+	_, err := apiClient.Builder("/booking/detail").
+		AddRequestInterceptor(func(r *http.Request) error {
+			order = append(order, "builder")
+			r.Header.Set("X-Tenant", "tenant-a")
+			return nil
+		}).
+		Call(context.Background(), &response)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(order) != "[config builder]" {
+		t.Errorf("unexpected interceptor order %v", order)
+	}
+	if response.Message != "tenant-a" || seenBody == "" {
+		t.Errorf("unexpected response %v, body %q", response, seenBody)
+	}
+}
+
+type NotFound struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"booking_not_found","detail":"no booking"}`))
+			return
+		}
+		w.Write([]byte(`{"statusCode":200,"message":"ok","data":[{"uuid":"1","name":"phuc"}]}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+
+	result, _, err := Do[CommonResult](context.Background(), apiClient.Builder("/booking"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Data) != 1 || result.Data[0].Name != "phuc" {
+		t.Errorf("unexpected result %v", result)
+	}
+
+	_, resp, err := DoWithError[CommonResult, NotFound](context.Background(), apiClient.Builder("/missing"))
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a 404 error, got %v", err)
+	}
+	model, ok := ErrorModel[NotFound](err)
+	if !ok || model.Code != "booking_not_found" {
+		t.Errorf("unexpected error model %v", model)
+	}
+}
+
+func TestOnStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req-1")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"booking_not_found","detail":"no booking"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	_, err := apiClient.Builder("/booking/detail").
+		OnStatus(http.StatusNotFound, &NotFound{}).
+		Call(context.Background(), nil)
+
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var apiErr GenericOpenAPIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected a GenericOpenAPIError, got %T", err)
+	}
+	if apiErr.StatusCode() != http.StatusNotFound || apiErr.Method() != http.MethodGet ||
+		apiErr.URL() != server.URL+"/booking/detail" || apiErr.Attempts() != 1 ||
+		apiErr.Header().Get("X-Request-Id") != "req-1" {
+		t.Errorf("unexpected error details %+v", apiErr)
+	}
+	if model, ok := apiErr.Model().(*NotFound); !ok || model.Code != "booking_not_found" {
+		t.Errorf("unexpected error model %v", apiErr.Model())
+	}
+}
+
+func TestMethods(t *testing.T) {
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, fmt.Sprintf("%s %s %s", r.Method, r.Header.Get("Content-Type"), strings.TrimSpace(string(body))))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"statusCode":200,"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	calls := []*builder{
+		apiClient.Builder("/booking").Patch().SetJSONPatch(
+			JSONPatchOperation{Op: "replace", Path: "/paid", Value: false},
+			JSONPatchOperation{Op: "remove", Path: "/note"},
+		),
+		apiClient.Builder("/booking").Patch().SetMergePatch(map[string]interface{}{"note": nil}),
+		apiClient.Builder("/booking").Head(),
+		apiClient.Builder("/booking").Method("PROPFIND"),
+	}
+	for _, call := range calls {
+		response := PostResponse{}
+		if _, err := call.Call(context.Background(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{
+		`PATCH application/json-patch+json [{"op":"replace","path":"/paid","value":false},{"op":"remove","path":"/note"}]`,
+		`PATCH application/merge-patch+json {"note":null}`,
+		`HEAD  `,
+		`PROPFIND  `,
+	}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("unexpected requests %q", received)
+	}
+}
+
+func TestCaptureTraffic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(`{"statusCode":200,"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	var (
+		dump                      string
+		requestDump, responseDump bytes.Buffer
+		response                  = PostResponse{}
+	)
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRedactHeader("X-Partner-Secret"))
+	_, err := apiClient.Builder("/booking").
+		Post().
+		SetBearerHeader("abc.xyz.123").
+		SetHeader("X-Partner-Secret", "s3cr3t").
+		SetBody(RequestBody{CompanyId: "1", Name: "phuc"}).
+		DumbOutRequest(&dump).
+		CaptureTraffic(&requestDump, &responseDump).
+		Call(context.Background(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dump != requestDump.String() || !strings.HasPrefix(dump, "POST /booking HTTP/1.1\r\n") {
+		t.Fatalf("unexpected request dump %q", dump)
+	}
+	if !strings.Contains(dump, "Authorization: [REDACTED]\r\n") || !strings.Contains(dump, "X-Partner-Secret: [REDACTED]\r\n") ||
+		strings.Contains(dump, "abc.xyz.123") || strings.Contains(dump, "s3cr3t") || !strings.Contains(dump, `"name":"phuc"`) {
+		t.Errorf("request dump is not redacted %q", dump)
+	}
+	if !strings.Contains(responseDump.String(), "Set-Cookie: [REDACTED]\r\n") || !strings.Contains(responseDump.String(), `"message":"ok"`) {
+		t.Errorf("unexpected response dump %q", responseDump.String())
+	}
+	if response.Message != "ok" {
+		t.Errorf("unexpected response %v", response)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"statusCode":200,"message":"` + strings.Repeat("x", 100) + `"}`))
+	}))
+	defer server.Close()
+
+	var entries []string
+	logger := LoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+		entries = append(entries, fmt.Sprintf("%s %s %v", level, msg, FieldsMap(fields)))
+	})
+
+	cfg := NewConfiguration().
+		AddBasePath(server.URL).
+		AddLogger(logger, LogLevelDebug).
+		AddRedactBodyField("password")
+	cfg.Debug = true
+	cfg.MaxLogBodySize = 60
+
+	apiClient := NewAPIClient(cfg)
+	_, err := apiClient.Builder("/login").
+		Post().
+		SetBody(map[string]string{"user": "phuc", "password": "s3cr3t"}).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %q", entries)
+	}
+	if !strings.HasPrefix(entries[0], "debug outgoing request") || strings.Contains(entries[0], "s3cr3t") ||
+		!strings.Contains(entries[0], `"password":"[REDACTED]"`) {
+		t.Errorf("unexpected request entry %q", entries[0])
+	}
+	if !strings.HasPrefix(entries[1], "info http request") || !strings.Contains(entries[1], "status:200") ||
+		!strings.Contains(entries[1], "method:POST") || !strings.Contains(entries[1], "attempt:1") {
+		t.Errorf("unexpected exchange entry %q", entries[1])
+	}
+	if !strings.HasPrefix(entries[2], "debug incoming response") || !strings.Contains(entries[2], "bytes truncated") {
+		t.Errorf("unexpected response entry %q", entries[2])
+	}
+}
+
+func TestLoggerLargeBody(t *testing.T) {
+	content := strings.Repeat("x", 1<<20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		} else {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	var entries []string
+	logger := LoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+		if msg == "incoming response" {
+			entries = append(entries, fmt.Sprint(FieldsMap(fields)["dump"]))
+		}
+	})
+	cfg := NewConfiguration().AddBasePath(server.URL).AddLogger(logger, LogLevelDebug)
+	cfg.Debug = true
+	cfg.MaxLogBodySize = 64
+	apiClient := NewAPIClient(cfg)
+
+	for _, path := range []string{"/length", "/chunked"} {
+		response, _, err := Do[string](context.Background(), apiClient.Builder(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response != content {
+			t.Errorf("%s: response of %d bytes, expected %d", path, len(response), len(content))
+		}
+	}
+	body, _, err := apiClient.Builder("/length").Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, _ := ioutil.ReadAll(body)
+	body.Close()
+	if len(streamed) != len(content) {
+		t.Errorf("streamed %d bytes, expected %d", len(streamed), len(content))
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if !strings.HasSuffix(entries[0], strings.Repeat("x", 64)+fmt.Sprintf("... (%d bytes truncated)", len(content)-64)) {
+		t.Errorf("unexpected dump %q", entries[0])
+	}
+	if !strings.HasSuffix(entries[1], strings.Repeat("x", 64)+"... (truncated)") {
+		t.Errorf("unexpected dump %q", entries[1])
+	}
+	if strings.Contains(entries[2], "xx") {
+		t.Errorf("streamed body dumped %q", entries[2])
+	}
+}
+
+type RequestMergedBody struct {
+	UUID      string `http:"uuid,path"`
+	CompanyId string `http:"companyId,body"`
+	Name      string `http:"name,body"`
+}
+
+func TestBuildRequestBody(t *testing.T) {
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r.URL.Path+" "+strings.TrimSpace(string(body)))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	requests := []interface{}{
+		&RequestCallback{
+			UUID: "1",
+			Body: RequestBody{CompanyId: "c1", Name: "phuc"},
+		},
+		RequestMergedBody{UUID: "2", CompanyId: "c2", Name: "phuc"},
+	}
+	for _, request := range requests {
+		if _, err := apiClient.Builder("/booking/:uuid").Post().BuildRequest(request).Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `[/booking/1 {"companyId":"c1","name":"phuc"} /booking/2 {"companyId":"c2","name":"phuc"}]`
+	if fmt.Sprint(received) != expected {
+		t.Errorf("unexpected requests %v", received)
+	}
+}
+
+type RequestCredentials struct {
+	AccessToken string    `http:"access-token,authorizationType"`
+	Basic       BasicAuth `http:"basic,basic"`
+	Key         string    `http:"key,apikey=X-Partner-Key"`
+	Tenant      string    `http:"X-Tenant,apikey"`
+}
+
+func TestBuildRequestAuth(t *testing.T) {
+	var received http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	requests := map[string]interface{}{
+		"Bearer ABC.xyz.123":     RequestCredentials{AccessToken: "ABC.xyz.123", Key: "k1", Tenant: "t1"},
+		"Basic cGh1YzpiaWdwaHVj": &RequestCredentials{Basic: BasicAuth{UserName: "phuc", Password: "bigphuc"}, Key: "k1", Tenant: "t1"},
+	}
+	for authorization, request := range requests {
+		if _, err := apiClient.Builder("/booking").BuildRequest(request).Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if received.Get("Authorization") != authorization || received.Get("X-Partner-Key") != "k1" || received.Get("X-Tenant") != "t1" {
+			t.Errorf("unexpected headers %v", received)
+		}
+	}
+}
+
+type RequestCollections struct {
+	IDs    []int    `http:"ids,query"`
+	Tags   []string `http:"tags,query,csv"`
+	Names  []string `http:"names,query,pipeDelimited"`
+	Words  []string `http:"words,query,ssv"`
+	Scopes []string `http:"X-Scopes,header"`
+	Files  []string `http:"files,form,explode"`
+}
+
+func TestCollectionFormats(t *testing.T) {
+	var (
+		query  string
+		header string
+		form   []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, header = r.URL.RawQuery, r.Header.Get("X-Scopes")
+		r.ParseForm()
+		form = r.PostForm["files"]
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	_, err := apiClient.Builder("/booking").
+		Post().
+		UseXFormURLEncoded().
+		BuildRequest(RequestCollections{
+			IDs:    []int{1, 2},
+			Tags:   []string{"a", "b c"},
+			Names:  []string{"x", "y"},
+			Words:  []string{"hello", "world"},
+			Scopes: []string{"read", "write"},
+			Files:  []string{"f1", "f2"},
+		}).
+		SetQueryCollection("tsv", []string{"t1", "t2"}, "tsv").
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ids=1&ids=2&names=x%7Cy&tags=a%2Cb+c&tsv=t1%09t2&words=hello+world"
+	if query != expected {
+		t.Errorf("unexpected query %q", query)
+	}
+	if header != "read,write" || fmt.Sprint(form) != "[f1 f2]" {
+		t.Errorf("unexpected header %q or form %v", header, form)
+	}
+}
+
+type Filter struct {
+	Name    string   `json:"name"`
+	Age     int      `json:"age"`
+	Tags    []string `json:"tags,omitempty"`
+	Address *Address `json:"address,omitempty"`
+}
+
+type Address struct {
+	City string `json:"city"`
+}
+
+type RequestFilters struct {
+	Deep    Filter            `http:"filter,query,deepObject"`
+	Dot     Filter            `http:"f,query,dot"`
+	JSON    map[string]string `http:"q,query,json"`
+	Default Filter            `http:"ignored,query"`
+}
+
+func TestObjectQuery(t *testing.T) {
+	var query url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	_, err := apiClient.Builder("/search").
+		BuildQuery(RequestFilters{
+			Deep:    Filter{Name: "x", Age: 3, Tags: []string{"a", "b"}, Address: &Address{City: "hcm"}},
+			Dot:     Filter{Name: "y", Age: 4},
+			JSON:    map[string]string{"status": "paid"},
+			Default: Filter{Name: "z", Age: 5},
+		}).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"filter[name]":          {"x"},
+		"filter[age]":           {"3"},
+		"filter[tags]":          {"a", "b"},
+		"filter[address][city]": {"hcm"},
+		"f.name":                {"y"},
+		"f.age":                 {"4"},
+		"q":                     {`{"status":"paid"}`},
+		"name":                  {"z"},
+		"age":                   {"5"},
+	}
+	if query.Encode() != expected.Encode() {
+		t.Errorf("unexpected query %v", query)
+	}
+}
+
+type Currency string
+
+func (c Currency) MarshalParam() (string, error) {
+	return strings.ToUpper(string(c)), nil
+}
+
+type Version int
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d", v)
+}
+
+type RequestValues struct {
+	From     time.Time  `http:"from,query,layout=2006-01-02"`
+	To       time.Time  `http:"to,query,unix"`
+	At       *time.Time `http:"at,query,unixmilli"`
+	Page     *int       `http:"page,query"`
+	Limit    *int       `http:"limit,query"`
+	Currency Currency   `http:"currency,query"`
+	IP       net.IP     `http:"ip,query"`
+	Version  Version    `http:"version,path"`
+	Trace    *string    `http:"X-Trace-Id,header"`
+}
+
+func TestParamMarshaling(t *testing.T) {
+	var (
+		query  url.Values
+		path   string
+		header http.Header
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, path, header = r.URL.Query(), r.URL.Path, r.Header
+	}))
+	defer server.Close()
+
+	page := 2
+	at := time.UnixMilli(1700000000123)
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	_, err := apiClient.Builder("/api/:version/rates").
+		BuildRequest(&RequestValues{
+			From:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			To:       time.Unix(1700000000, 0),
+			At:       &at,
+			Page:     &page,
+			Currency: "vnd",
+			IP:       net.ParseIP("10.0.0.1"),
+			Version:  2,
+		}).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"from":     {"2024-01-02"},
+		"to":       {"1700000000"},
+		"at":       {"1700000000123"},
+		"page":     {"2"},
+		"currency": {"VND"},
+		"ip":       {"10.0.0.1"},
+	}
+	if query.Encode() != expected.Encode() {
+		t.Errorf("unexpected query %v", query)
+	}
+	if path != "/api/v2/rates" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if _, ok := header["X-Trace-Id"]; ok {
+		t.Errorf("nil header was sent: %v", header)
+	}
+}
+
+type RateLimitHeader struct {
+	Remaining *int      `http:"X-RateLimit-Remaining,header" json:"-"`
+	Reset     time.Time `http:"X-RateLimit-Reset,header,unix" json:"-"`
+}
+
+type HeaderResponse struct {
+	RateLimitHeader
+	Message      string        `json:"message"`
+	RequestID    string        `http:"X-Request-Id,header" json:"-"`
+	LastModified time.Time     `http:"Last-Modified,header" json:"-"`
+	RetryAfter   time.Duration `http:"Retry-After,header" json:"-"`
+	Links        []string      `http:"Link,header" json:"-"`
+	Missing      string        `http:"X-Missing,header" json:"-"`
+}
+
+func TestResponseHeader(t *testing.T) {
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "abc")
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		w.Header().Set("X-RateLimit-Reset", "1700000000")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Retry-After", "3")
+		w.Header().Add("Link", `</page/2>; rel="next"`)
+		w.Header().Add("Link", `</page/9>; rel="last"`)
+		w.Write([]byte(`{"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	response := HeaderResponse{Missing: "kept"}
+	_, err := apiClient.Builder("/booking").Call(context.Background(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Message != "ok" || response.RequestID != "abc" || response.Missing != "kept" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if response.Remaining == nil || *response.Remaining != 42 || response.Reset.Unix() != 1700000000 {
+		t.Errorf("unexpected rate limit %+v", response.RateLimitHeader)
+	}
+	if !response.LastModified.Equal(lastModified) || response.RetryAfter != 3*time.Second {
+		t.Errorf("unexpected times %v %v", response.LastModified, response.RetryAfter)
+	}
+	if len(response.Links) != 2 {
+		t.Errorf("unexpected links %q", response.Links)
+	}
+
+	result, _, err := Do[HeaderResponse](context.Background(), apiClient.Builder("/booking").Head())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequestID != "abc" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+type RequestValidated struct {
+	UUID   string            `http:"uuid,path,required"`
+	Token  string            `http:"X-Token,header,required"`
+	Limit  int               `http:"limit,query,min=1,max=100"`
+	Code   string            `http:"code,query,omitempty,pattern=^[A-Z]{3}$"`
+	Status string            `http:"status,query,enum=paid|unpaid"`
+	Body   *RequestValidBody `http:"body,body"`
+}
+
+type RequestValidBody struct {
+	Name string `http:"name,required" json:"name"`
+}
+
+func (r RequestValidated) Validate() error {
+	if r.Status == "paid" && r.Code == "" {
+		return errors.New("a paid request needs a code")
+	}
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+
+	request := RequestValidated{Limit: 500, Code: "abc", Status: "void", Body: &RequestValidBody{}}
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	_, err := apiClient.Builder("/booking/:uuid").
+		Post().
+		BuildPath(request).
+		BuildRequest(request).
+		Call(context.Background(), nil)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("the request was sent")
+	}
+
+	rules := make(map[string]string)
+	for _, field := range validationErr.Fields {
+		rules[field.Field] = field.Rule
+	}
+	expected := map[string]string{
+		"UUID":      "required",
+		"Token":     "required",
+		"Limit":     "max",
+		"Code":      "pattern",
+		"Status":    "enum",
+		"Body.Name": "required",
+	}
+	if len(validationErr.Fields) != len(expected) {
+		t.Errorf("unexpected fields %v", validationErr.Fields)
+	}
+	for field, rule := range expected {
+		if rules[field] != rule {
+			t.Errorf("expected %s to fail %s, got %v", field, rule, validationErr)
+		}
+	}
+
+	// zero values are sent, except with omitempty
+	_, err = apiClient.Builder("/booking/:uuid").
+		BuildRequest(RequestValidated{UUID: "1", Token: "t"}).
+		Call(context.Background(), nil)
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 2 ||
+		validationErr.Fields[0].Rule != "min" || validationErr.Fields[1].Rule != "enum" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	_, err = apiClient.Builder("/booking/:uuid").
+		BuildRequest(RequestValidated{UUID: "1", Token: "t", Limit: 1, Status: "paid"}).
+		Call(context.Background(), nil)
+	if !errors.As(err, &validationErr) || len(validationErr.Fields) != 1 || validationErr.Fields[0].Rule != "validate" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	_, err = apiClient.Builder("/booking/:uuid").
+		BuildRequest(RequestValidated{UUID: "1", Token: "t", Limit: 1, Code: "ABC", Status: "paid"}).
+		Call(context.Background(), nil)
+	if err != nil || calls != 1 {
+		t.Errorf("unexpected error %v after %d calls", err, calls)
+	}
+}
+
+type RequestPath struct {
+	ID         string `http:"id,path"`
+	Identifier string `http:"identifier,path"`
+	File       string `http:"file,path,raw"`
+}
+
+func TestPathTemplate(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	_, err := apiClient.Builder("/items/:identifier/:id/{file}/v1:batchGet").
+		BuildPath(RequestPath{ID: "a b/c", Identifier: "x", File: "docs/a.txt"}).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiClient.Builder("/files/*path").
+		SetPath("path", "dir/my file.txt").
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/items/x/a%20b%2Fc/docs/a.txt/v1:batchGet", "/files/dir/my%20file.txt"}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("unexpected paths %q", paths)
+	}
+
+	_, err = apiClient.Builder("/items/{id}/:name").
+		SetPath("id", 1).
+		Call(context.Background(), nil)
+	if !errors.Is(err, ErrUnresolvedPath) || !strings.Contains(err.Error(), "name") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("a request with an unresolved path was sent")
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		basePath, uri, expected string
+	}{
+		{"http://api.test/v1", "/booking", "http://api.test/v1/booking"},
+		{"http://api.test/v1/", "/booking", "http://api.test/v1/booking"},
+		{"http://api.test/v1", "booking", "http://api.test/v1/booking"},
+		{"http://api.test", "/booking", "http://api.test/booking"},
+		{"http://api.test/v1", "", "http://api.test/v1"},
+		{"http://api.test/v1/", "../v2/booking", "http://api.test/v2/booking"},
+		{"http://api.test/v1?key=1", "/booking?page=2", "http://api.test/v1/booking?key=1&page=2"},
+		{"http://api.test/v1", "/items/a%2Fb", "http://api.test/v1/items/a%2Fb"},
+		{"http://api.test/v1", "/v1:batchGet", "http://api.test/v1/v1:batchGet"},
+		{"http://api.test/v1", "https://other.test/booking?page=3", "https://other.test/booking?page=3"},
+		{"", "/booking", "/booking"},
+	}
+	for _, test := range tests {
+		url, err := resolveURL(test.basePath, test.uri)
+		if err != nil || url != test.expected {
+			t.Errorf("resolveURL(%q, %q) = %q, %v, expected %q", test.basePath, test.uri, url, err, test.expected)
+		}
+	}
+}
+
+func TestAbsoluteURI(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath("http://unused.test/v1"))
+	_, err := apiClient.Builder(server.URL + "/booking?page=2").
+		SetQuery("size", 10).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != "/booking?page=2&size=10" {
+		t.Errorf("unexpected request %q", requested)
+	}
+}
+
+func TestServers(t *testing.T) {
+	var hits []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, r.URL.Path)
+	}))
+	defer server.Close()
+
+	cfg := NewConfiguration().
+		AddBasePath("http://unused.test").
+		AddServer(ServerConfiguration{
+			Name: "sandbox",
+			Url:  server.URL + "/{version}/{env}",
+			Variables: map[string]ServerVariable{
+				"version": {DefaultValue: "v1"},
+				"env":     {DefaultValue: "sandbox", EnumValues: []string{"sandbox", "live"}},
+			},
+		}).
+		AddOperationServer("upload", ServerConfiguration{Url: server.URL + "/upload"})
+	apiClient := NewAPIClient(cfg)
+
+	ctx := context.WithValue(context.Background(), ContextServerVariables, map[string]string{"version": "v2"})
+	if _, err := apiClient.Builder("/booking").UseServerName("sandbox").Call(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.WithValue(ctx, ContextServerIndex, 0)
+	if _, err := apiClient.Builder("/booking").SetServerVariable("env", "live").Call(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apiClient.Builder("/files").Operation("upload").Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/v2/sandbox/booking", "/v2/live/booking", "/upload/files"}
+	if strings.Join(hits, " ") != strings.Join(expected, " ") {
+		t.Errorf("unexpected paths %q", hits)
+	}
+
+	if len(cfg.Servers) != 1 {
+		t.Errorf("unexpected servers %v", cfg.Servers)
+	}
+	_, err := apiClient.Builder("/booking").UseServer(0).SetServerVariable("env", "test").Call(context.Background(), nil)
+	if err == nil || len(hits) != 3 {
+		t.Errorf("expected an invalid variable error, got %v", err)
+	}
+	_, err = apiClient.Builder("/booking").UseServerName("missing").Call(context.Background(), nil)
+	if err == nil || len(hits) != 3 {
+		t.Errorf("expected an unknown server error, got %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// XFromCache is the header set to "1" on the responses answered from the cache, see FromCache.
+const XFromCache = "X-From-Cache"
+
+// Cache is a private HTTP cache for GET and HEAD requests, following RFC 9111.
+//
+// A response is stored when its status code is cacheable, neither the request nor the response
+// says no-store, it does not vary on every header, and it has a freshness lifetime (max-age or
+// Expires) or a validator (ETag or Last-Modified). A stored response answers the requests with
+// the same URL and the same values of the headers listed by its Vary header. While it is fresh,
+// according to CacheExpires, it is returned as is. Once stale, it is revalidated with
+// If-None-Match and If-Modified-Since, and a 304 refreshes it. Within the stale-while-revalidate
+// window it is still returned while a revalidation runs in the background. A no-cache directive,
+// in the request or the response, forces the revalidation. A successful POST, PUT, PATCH or
+// DELETE removes the stored responses of its URL.
+//
+// Requests are matched as they are prepared, before the request interceptors run, so a response
+// varying on a header set by an interceptor is not stored. Requests carrying their own conditional
+// or Range headers are sent as is.
+type Cache struct {
+	// Store holds the stored responses.
+	Store CacheStore
+
+	revalidating sync.Map
+}
+
+// NewCache returns a cache keeping its responses in the store.
+func NewCache(store CacheStore) *Cache {
+	return &Cache{Store: store}
+}
+
+// FromCache reports whether the response was answered from the cache, possibly after a revalidation.
+func FromCache(resp *http.Response) bool {
+	return resp != nil && resp.Header.Get(XFromCache) == "1"
+}
+
+// cacheEntry is a stored response.
+type cacheEntry struct {
+	// Response is the dump of the response.
+	Response []byte `json:"response"`
+	// Vary holds the values of the request headers listed by the Vary header of the response.
+	Vary map[string]string `json:"vary,omitempty"`
+}
+
+// cacheKey returns the key of the stored response of a request.
+func cacheKey(method string, req *http.Request) string {
+	return method + " " + req.URL.String()
+}
+
+// response reads the stored response back.
+func (e *cacheEntry) response(req *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(e.Response)), req)
+}
+
+// load returns the stored response matching the request.
+func (cache *Cache) load(key string, req *http.Request) (*cacheEntry, bool) {
+	data, ok := cache.Store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		cache.Store.Delete(key)
+		return nil, false
+	}
+	for name, value := range entry.Vary {
+		if req.Header.Get(name) != value {
+			return nil, false
+		}
+	}
+	return &entry, true
+}
+
+// save stores the response, reading its body and replacing it with an in-memory copy.
+func (cache *Cache) save(key string, req *http.Request, resp *http.Response) error {
+	dump, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	entry := cacheEntry{Response: dump}
+	for _, name := range strings.Split(resp.Header.Get("Vary"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if entry.Vary == nil {
+				entry.Vary = make(map[string]string)
+			}
+			entry.Vary[name] = req.Header.Get(name)
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	cache.Store.Set(key, data)
+	return nil
+}
+
+// storable reports whether the response to the request can be stored.
+func storable(req *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent, http.StatusMultipleChoices,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+	if _, ok := parseCacheControl(req.Header)["no-store"]; ok {
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if strings.TrimSpace(resp.Header.Get("Vary")) == "*" {
+		return false
+	}
+	_, maxAge := cc["max-age"]
+	return maxAge || resp.Header.Get("Expires") != "" || resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// variedByInterceptors reports whether the request interceptors changed, on the request as sent,
+// one of the headers listed by the Vary header of a response, so that the request as prepared
+// does not match the response.
+func variedByInterceptors(req, sent *http.Request, header http.Header) bool {
+	if sent == nil {
+		return false
+	}
+	for _, name := range strings.Split(header.Get("Vary"), ",") {
+		if name = strings.TrimSpace(name); name != "" && req.Header.Get(name) != sent.Header.Get(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheExpires returns when a stored response becomes stale, taking its Age header into account.
+func cacheExpires(resp *http.Response) time.Time {
+	expires := CacheExpires(resp)
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && age > 0 {
+		expires = expires.Add(-time.Duration(age) * time.Second)
+	}
+	return expires
+}
+
+// staleWhileRevalidate returns the stale-while-revalidate window of a response.
+func staleWhileRevalidate(cc cacheControl) (time.Duration, bool) {
+	value, ok := cc["stale-while-revalidate"]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// sendCached answers the request from the cache, revalidating the stored response when it is
+// stale, or sends it and stores the response. The request is matched as it is prepared, before
+// the request interceptors run.
+func (c *APIClient) sendCached(cache *Cache, request *http.Request, opts callOptions) (*http.Response, int, error) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		resp, attempts, err := c.sendAttempts(request, opts)
+		if err == nil && resp.StatusCode < 400 && request.Method != http.MethodOptions {
+			cache.Store.Delete(cacheKey(http.MethodGet, request))
+			cache.Store.Delete(cacheKey(http.MethodHead, request))
+		}
+		return resp, attempts, err
+	}
+
+	// The body of a streamed response is never held in memory to be stored
+	reqCC := parseCacheControl(request.Header)
+	if _, noStore := reqCC["no-store"]; noStore || opts.streamResponse ||
+		request.Header.Get("If-None-Match") != "" ||
+		request.Header.Get("If-Modified-Since") != "" ||
+		request.Header.Get("Range") != "" {
+		return c.sendAttempts(request, opts)
+	}
+
+	key := cacheKey(request.Method, request)
+	entry, ok := cache.load(key, request)
+	if !ok {
+		resp, attempts, err := c.sendAttempts(request, opts)
+		if err == nil && storable(request, resp) && !variedByInterceptors(request, resp.Request, resp.Header) {
+			err = cache.save(key, request, resp)
+		}
+		return resp, attempts, err
+	}
+
+	resp, err := entry.response(request)
+	if err != nil {
+		cache.Store.Delete(key)
+		return c.sendAttempts(request, opts)
+	}
+
+	var (
+		ctx     = request.Context()
+		respCC  = parseCacheControl(resp.Header)
+		expires = cacheExpires(resp)
+		now     = time.Now()
+	)
+	_, noCache := reqCC["no-cache"]
+	_, always := respCC["no-cache"]
+	if !noCache && !always {
+		if now.Before(expires) {
+			c.log(ctx, LogLevelDebug, "response from cache", LogField{Key: "url", Value: request.URL.String()})
+			resp.Header.Set(XFromCache, "1")
+			return resp, 0, nil
+		}
+		_, mustRevalidate := respCC["must-revalidate"]
+		if window, ok := staleWhileRevalidate(respCC); ok && !mustRevalidate && now.Before(expires.Add(window)) {
+			c.log(ctx, LogLevelDebug, "stale response from cache", LogField{Key: "url", Value: request.URL.String()})
+			c.revalidateInBackground(cache, key, request, opts, entry)
+			resp.Header.Set(XFromCache, "1")
+			return resp, 0, nil
+		}
+	}
+	return c.revalidate(cache, key, request, opts, resp)
+}
+
+// revalidate sends a conditional request for the stored response. A 304 refreshes the stored
+// response, which is returned, otherwise the new response is stored and returned.
+func (c *APIClient) revalidate(cache *Cache, key string, request *http.Request, opts callOptions, stored *http.Response) (*http.Response, int, error) {
+	req := request.Clone(request.Context())
+	if etag := stored.Header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := stored.Header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, attempts, err := c.sendAttempts(req, opts)
+	if err != nil {
+		stored.Body.Close()
+		return resp, attempts, err
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		stored.Body.Close()
+		if storable(request, resp) && !variedByInterceptors(request, resp.Request, resp.Header) {
+			err = cache.save(key, request, resp)
+		} else {
+			cache.Store.Delete(key)
+		}
+		return resp, attempts, err
+	}
+
+	drainBody(resp)
+	for name, values := range resp.Header {
+		if name != "Content-Length" {
+			stored.Header[name] = values
+		}
+	}
+	if variedByInterceptors(request, resp.Request, stored.Header) {
+		cache.Store.Delete(key)
+	} else if err := cache.save(key, request, stored); err != nil {
+		return nil, attempts, err
+	}
+	c.log(request.Context(), LogLevelDebug, "response revalidated", LogField{Key: "url", Value: request.URL.String()})
+	stored.Header.Set(XFromCache, "1")
+	return stored, attempts, nil
+}
+
+// revalidateInBackground revalidates a stored response, unless it is already being revalidated,
+// without waiting for it and whatever happens to the context of the request.
+func (c *APIClient) revalidateInBackground(cache *Cache, key string, request *http.Request, opts callOptions, entry *cacheEntry) {
+	if _, busy := cache.revalidating.LoadOrStore(key, true); busy {
+		return
+	}
+
+	req := request.Clone(context.WithoutCancel(request.Context()))
+	stored, err := entry.response(req)
+	if err != nil {
+		cache.revalidating.Delete(key)
+		return
+	}
+	// the caller owns the buffers of the call
+	opts.dumpRequestOut, opts.captureRequest, opts.captureResponse = nil, nil, nil
+
+	go func() {
+		defer cache.revalidating.Delete(key)
+		resp, _, err := c.revalidate(cache, key, req, opts, stored)
+		if err == nil {
+			drainBody(resp)
+		}
+	}()
+}
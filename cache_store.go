@@ -0,0 +1,132 @@
+package builder
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStore holds the responses stored by a Cache. Its methods may be called concurrently.
+type CacheStore interface {
+	// Get returns the value stored under key.
+	Get(key string) ([]byte, bool)
+	// Set stores the value under key.
+	Set(key string, value []byte)
+	// Delete removes the value stored under key.
+	Delete(key string)
+}
+
+// memoryCache is a CacheStore keeping the most recently used values in memory.
+type memoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    *list.List
+	items      map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a CacheStore keeping up to maxEntries values in memory, evicting the
+// least recently used ones. A maxEntries of 0 means no limit.
+func NewMemoryCache(maxEntries int) CacheStore {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		entries:    list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (m *memoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	m.entries.MoveToFront(element)
+	return element.Value.(*memoryEntry).value, true
+}
+
+func (m *memoryCache) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.items[key]; ok {
+		element.Value.(*memoryEntry).value = value
+		m.entries.MoveToFront(element)
+		return
+	}
+	m.items[key] = m.entries.PushFront(&memoryEntry{key: key, value: value})
+	if m.maxEntries > 0 && m.entries.Len() > m.maxEntries {
+		oldest := m.entries.Back()
+		m.entries.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+func (m *memoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if element, ok := m.items[key]; ok {
+		m.entries.Remove(element)
+		delete(m.items, key)
+	}
+}
+
+// diskCache is a CacheStore keeping a file per value in a directory.
+type diskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a CacheStore keeping a file per value in dir, created when needed.
+func NewDiskCache(dir string) CacheStore {
+	return &diskCache{dir: dir}
+}
+
+// path returns the file of a key.
+func (d *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+func (d *diskCache) Get(key string) ([]byte, bool) {
+	value, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func (d *diskCache) Set(key string, value []byte) {
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return
+	}
+	// Write a temporary file first so that a reader never sees a partial value
+	file, err := ioutil.TempFile(d.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = file.Write(value)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+func (d *diskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
@@ -0,0 +1,204 @@
+package builder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+		}
+		w.Write([]byte(`{"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddCache(NewCache(NewMemoryCache(10))))
+	call := func(b *builder) (*http.Response, PostResponse) {
+		t.Helper()
+		var response PostResponse
+		resp, err := b.Call(context.Background(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, response
+	}
+	expect := func(path string, expectedHits int32, fromCache bool, resp *http.Response, response PostResponse) {
+		t.Helper()
+		if n := atomic.SwapInt32(&hits, 0); n != expectedHits {
+			t.Errorf("%s: %d hits, expected %d", path, n, expectedHits)
+		}
+		if FromCache(resp) != fromCache || response.Message != "ok" {
+			t.Errorf("%s: unexpected response %v from cache %v", path, response, FromCache(resp))
+		}
+	}
+
+	call(apiClient.Builder("/fresh"))
+	resp, response := call(apiClient.Builder("/fresh"))
+	expect("/fresh", 1, true, resp, response)
+
+	call(apiClient.Builder("/etag"))
+	resp, response = call(apiClient.Builder("/etag"))
+	expect("/etag", 2, true, resp, response)
+
+	call(apiClient.Builder("/vary").SetHeader("Accept-Language", "en"))
+	resp, response = call(apiClient.Builder("/vary").SetHeader("Accept-Language", "vi"))
+	expect("/vary", 2, false, resp, response)
+
+	call(apiClient.Builder("/no-store"))
+	resp, response = call(apiClient.Builder("/no-store"))
+	expect("/no-store", 2, false, resp, response)
+
+	// A successful POST removes the stored responses of its URL
+	call(apiClient.Builder("/fresh").Post())
+	resp, response = call(apiClient.Builder("/fresh"))
+	expect("/fresh after POST", 2, false, resp, response)
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	revalidated := make(chan struct{}, 1)
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) > 1 {
+			defer func() { revalidated <- struct{}{} }()
+		}
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer server.Close()
+
+	store := NewDiskCache(t.TempDir())
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddCache(NewCache(store)))
+	for i := 0; i < 2; i++ {
+		resp, err := apiClient.Builder("/booking").Call(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if FromCache(resp) != (i == 1) {
+			t.Errorf("call %d from cache %v", i, FromCache(resp))
+		}
+	}
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("the stale response was not revalidated")
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	store := NewMemoryCache(2)
+	store.Set("a", []byte("1"))
+	store.Set("b", []byte("2"))
+	store.Get("a")
+	store.Set("c", []byte("3"))
+
+	if _, ok := store.Get("b"); ok {
+		t.Error("the least recently used value was not evicted")
+	}
+	if value, ok := store.Get("a"); !ok || string(value) != "1" {
+		t.Errorf("unexpected value %q", value)
+	}
+}
+
+func TestCacheInterceptedRequest(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "X-Tenant")
+		w.Write([]byte(`{"message":"` + r.Header.Get("X-Tenant") + `"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddCache(NewCache(NewMemoryCache(10))))
+	var runs int32
+	tenant := func(name string) RequestInterceptor {
+		return func(r *http.Request) error {
+			atomic.AddInt32(&runs, 1)
+			r.Header.Set("X-Tenant", name)
+			return nil
+		}
+	}
+	// The response varies on a header set by an interceptor, it is never stored
+	for _, name := range []string{"a", "a", "b", "b"} {
+		var response PostResponse
+		if _, err := apiClient.Builder("/country").AddRequestInterceptor(tenant(name)).Call(context.Background(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Message != name {
+			t.Errorf("tenant %s got the response of %q", name, response.Message)
+		}
+	}
+	if n := atomic.SwapInt32(&hits, 0); n != 4 {
+		t.Errorf("%d hits, expected 4", n)
+	}
+	if n := atomic.SwapInt32(&runs, 0); n != 4 {
+		t.Errorf("interceptors ran %d times, expected 4", n)
+	}
+
+	// The interceptors run for the requests sent only
+	trace := func(r *http.Request) error {
+		atomic.AddInt32(&runs, 1)
+		r.Header.Set("X-Trace", strconv.Itoa(int(atomic.LoadInt32(&runs))))
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := apiClient.Builder("/city").AddRequestInterceptor(trace).Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := apiClient.Builder("/city").Post().AddRequestInterceptor(trace).Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.SwapInt32(&hits, 0); n != 2 {
+		t.Errorf("%d hits, expected 2", n)
+	}
+	if n := atomic.SwapInt32(&runs, 0); n != 2 {
+		t.Errorf("interceptors ran %d times, expected 2", n)
+	}
+
+	// A streamed response is not stored
+	for i := 0; i < 2; i++ {
+		body, _, err := apiClient.Builder("/stream").Stream(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		body.Close()
+	}
+	if _, err := apiClient.Builder("/stream").Call(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("%d hits, expected 3", n)
+	}
+}
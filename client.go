@@ -8,7 +8,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"net/http/httputil"
@@ -25,7 +24,7 @@ import (
 )
 
 var (
-	jsonCheck = regexp.MustCompile(`(?i:(?:application|text)/(?:vnd\.[^;]+\+)?json)`)
+	jsonCheck = regexp.MustCompile(`(?i:(?:application|text)/(?:[^;]+\+)?json)`)
 	xmlCheck  = regexp.MustCompile(`(?i:(?:application|text)/xml)`)
 )
 
@@ -34,6 +33,7 @@ var (
 type APIClient struct {
 	cfg     *Configuration
 	service // Reuse a single struct instead of allocating one for each service on the heap.
+	flights flightGroup
 }
 
 type service struct {
@@ -104,26 +104,8 @@ func typeCheckParameter(obj interface{}, expected string, name string) error {
 
 // parameterToString convert interface{} parameters to string, using a delimiter if format is provided.
 func parameterToString(obj interface{}, collectionFormat string) string {
-	var delimiter string
-
-	switch collectionFormat {
-	case "pipes":
-		delimiter = "|"
-	case "ssv":
-		delimiter = " "
-	case "tsv":
-		delimiter = "\t"
-	case "csv":
-		delimiter = ","
-	}
-
-	if reflect.TypeOf(obj).Kind() == reflect.Slice {
-		return strings.Trim(strings.Replace(fmt.Sprint(obj), " ", delimiter, -1), "[]")
-	} else if t, ok := obj.(time.Time); ok {
-		return t.Format(time.RFC3339)
-	}
-
-	return fmt.Sprintf("%v", obj)
+	s, _, _ := formatParameter(obj, collectionFormat, nil)
+	return s
 }
 
 // helper for converting interface{} parameters to json strings
@@ -136,33 +118,204 @@ func parameterToJson(obj interface{}) (string, error) {
 }
 
 // callAPI do the request.
-func (c *APIClient) callAPI(request *http.Request, dumpOutGoingRequest *string) (*http.Response, error) {
-	if c.cfg.Debug {
-		dump, err := httputil.DumpRequestOut(request, true)
-		dumpString := string(dump)
-		dumpOutGoingRequest = &dumpString
+func (c *APIClient) callAPI(request *http.Request, opts callOptions, attempt int) (*http.Response, error) {
+	captureRequest := opts.dumpRequestOut != nil || opts.captureRequest != nil
+	if c.cfg.Debug || captureRequest {
+		// Do not buffer a streamed body just to dump it
+		dump, err := httputil.DumpRequestOut(request, !opts.streamBody)
 		if err != nil {
 			return nil, err
 		}
-		log.Printf("\n%s\n", string(dump))
+		dump = redactDump(dump, c.cfg.RedactHeaders)
+		if opts.dumpRequestOut != nil {
+			*opts.dumpRequestOut = string(dump)
+		}
+		if opts.captureRequest != nil {
+			opts.captureRequest.Reset()
+			opts.captureRequest.Write(dump)
+		}
+		if c.cfg.Debug {
+			c.log(request.Context(), LogLevelDebug, "outgoing request", LogField{Key: "dump", Value: c.logDump(dump, 0)})
+		}
 	}
 
+	start := time.Now()
 	resp, err := c.cfg.HTTPClient.Do(request)
+	c.logExchange(request, resp, err, attempt, time.Since(start))
 	if err != nil {
 		return resp, err
 	}
 
-	if c.cfg.Debug {
-		dump, err := httputil.DumpResponse(resp, true)
+	if c.cfg.Debug || opts.captureResponse != nil {
+		// Never read a streamed body, and no more of a body than is logged
+		dump, rest, err := dumpResponse(resp, !opts.streamResponse, c.cfg.MaxLogBodySize)
 		if err != nil {
-			return resp, err
+			// the body is partly read: free the connection
+			resp.Body.Close()
+			return nil, err
+		}
+		dump = redactDump(dump, c.cfg.RedactHeaders)
+		if opts.captureResponse != nil {
+			opts.captureResponse.Reset()
+			opts.captureResponse.Write(dump)
+		}
+		if c.cfg.Debug {
+			c.log(request.Context(), LogLevelDebug, "incoming response", LogField{Key: "dump", Value: c.logDump(dump, rest)})
 		}
-		log.Printf("\n%s\n", string(dump))
 	}
 
 	return resp, err
 }
 
+// send do the request, answering it from the cache of the configuration when it can.
+// It also returns the number of attempts made.
+func (c *APIClient) send(request *http.Request, opts callOptions) (*http.Response, int, error) {
+	if c.cfg.Cache != nil {
+		return c.sendCached(c.cfg.Cache, request, opts)
+	}
+	return c.sendAttempts(request, opts)
+}
+
+// sendAttempts do the request, running the request interceptors and retrying it according to the policy.
+// It also returns the number of attempts made.
+func (c *APIClient) sendAttempts(request *http.Request, opts callOptions) (*http.Response, int, error) {
+	policy := opts.retryPolicy
+	if policy == nil || policy.MaxAttempts < 1 {
+		policy = &RetryPolicy{MaxAttempts: 1}
+	}
+
+	var (
+		ctx   = request.Context()
+		tried = make(map[string]bool)
+	)
+	for attempt := 1; ; attempt++ {
+		req := request.Clone(ctx)
+		if attempt > 1 {
+			var err error
+			if req, err = rewindRequest(request); err != nil {
+				return nil, attempt, err
+			}
+		}
+
+		resp, err := c.attempt(req, opts, attempt, tried)
+		if errors.Is(err, ErrCircuitOpen) {
+			return nil, attempt, err
+		}
+		if attempt >= policy.MaxAttempts || !policy.shouldRetry(request, resp, err) {
+			return resp, attempt, err
+		}
+		if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+			return resp, attempt, err
+		}
+
+		wait := policy.wait(attempt, resp)
+		drainBody(resp)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends one attempt of a request to the server picked by the load balancer, when the
+// circuit breaker lets it through and once the rate limiter does.
+func (c *APIClient) attempt(req *http.Request, opts callOptions, attempt int, tried map[string]bool) (*http.Response, error) {
+	var (
+		ctx      = req.Context()
+		balancer = c.cfg.LoadBalancer
+		breaker  = c.cfg.CircuitBreaker
+		limiter  = c.cfg.RateLimiter
+		server   string
+		circuit  string
+		allowed  bool
+		release  = func() {}
+	)
+	// abort forgets an attempt that is not sent
+	abort := func(err error) (*http.Response, error) {
+		if server != "" {
+			balancer.release(server)
+		}
+		if allowed {
+			breaker.release(circuit)
+		}
+		release()
+		return nil, err
+	}
+
+	// A balanced request refused by the circuit of its server moves on to the next server
+	var refused map[string]bool
+	for {
+		if opts.balanced != nil && balancer != nil {
+			servers := without(opts.balanced.servers, refused)
+			server = balancer.pick(servers, tried)
+			tried[server] = true
+			if err := opts.balanced.apply(c, req, server); err != nil {
+				return abort(err)
+			}
+		}
+		if breaker == nil {
+			break
+		}
+
+		circuit = breaker.key(req, opts.route)
+		change, err := breaker.allow(circuit)
+		c.circuitChanged(ctx, breaker, change)
+		if err == nil {
+			allowed = true
+			break
+		}
+		if server == "" {
+			return abort(err)
+		}
+		balancer.release(server)
+		if refused == nil {
+			refused = make(map[string]bool)
+		}
+		refused[server], server = true, ""
+		if len(without(opts.balanced.servers, refused)) == 0 {
+			return abort(err)
+		}
+		c.log(ctx, LogLevelDebug, "circuit open, trying the next server", LogField{Key: "circuit", Value: circuit})
+	}
+
+	if limiter != nil {
+		slot, err := limiter.wait(ctx, req.URL.Host, opts.route)
+		if err != nil {
+			return abort(err)
+		}
+		release = slot
+	}
+
+	if err := interceptRequest(req, opts.requestInterceptors); err != nil {
+		return abort(err)
+	}
+
+	resp, err := c.callAPI(req, opts, attempt)
+	if limiter != nil {
+		limiter.observe(req.URL.Host, resp)
+	}
+	if resp != nil && resp.Body != nil {
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	} else {
+		release()
+	}
+	if allowed {
+		c.circuitChanged(ctx, breaker, breaker.record(circuit, resp, err))
+	}
+	if server != "" && balancer.done(server, resp, err) {
+		if balancer.Healthy(server) {
+			c.log(ctx, LogLevelInfo, "server healthy again", LogField{Key: "server", Value: server})
+		} else {
+			c.log(ctx, LogLevelWarn, "server marked unhealthy", LogField{Key: "server", Value: server})
+		}
+	}
+	return resp, err
+}
+
 // ChangeBasePath changes base path to allow switching to mocks
 func (c *APIClient) ChangeBasePath(path string) {
 	c.cfg.BasePath = path
@@ -182,11 +335,30 @@ func (c *APIClient) prepareRequest(
 	headerParams map[string]string,
 	queryParams url.Values,
 	formParams url.Values,
-	formFileName string,
-	fileName string,
-	fileBytes []byte) (localVarRequest *http.Request, err error) {
-
-	var body *bytes.Buffer
+	parts []formPart,
+	streamBody bool,
+	contentLength int64) (localVarRequest *http.Request, err error) {
+
+	var (
+		body    *bytes.Buffer
+		stream  io.Reader
+		getBody func() (io.ReadCloser, error)
+	)
+
+	// Pass a reader body through as is.
+	if streamBody && isStreamable(postBody) {
+		if headerParams["Content-Type"] == "" {
+			headerParams["Content-Type"] = "application/octet-stream"
+		}
+		stream, getBody, err = streamReader(postBody)
+		if err != nil {
+			return nil, err
+		}
+		if contentLength < 0 {
+			contentLength = readerLen(stream)
+		}
+		postBody = nil
+	}
 
 	// Detect postBody type and post.
 	if postBody != nil {
@@ -203,48 +375,41 @@ func (c *APIClient) prepareRequest(
 	}
 
 	// add form parameters and file if available.
-	if strings.HasPrefix(headerParams["Content-Type"], "multipart/form-data") && len(formParams) > 0 || (len(fileBytes) > 0 && fileName != "") {
-		if body != nil {
+	if strings.HasPrefix(headerParams["Content-Type"], "multipart/form-data") && len(formParams) > 0 || len(parts) > 0 {
+		if body != nil || stream != nil {
 			return nil, errors.New("Cannot specify postBody and multipart form at the same time.")
 		}
-		body = &bytes.Buffer{}
-		w := multipart.NewWriter(body)
-
-		for k, v := range formParams {
-			for _, iv := range v {
-				if strings.HasPrefix(k, "@") { // file
-					err = addFile(w, k[1:], iv)
-					if err != nil {
-						return nil, err
-					}
-				} else { // form value
-					w.WriteField(k, iv)
-				}
-			}
-		}
-		if len(fileBytes) > 0 && fileName != "" {
-			w.Boundary()
-			//_, fileNm := filepath.Split(fileName)
-			part, err := w.CreateFormFile(formFileName, filepath.Base(fileName))
-			if err != nil {
+
+		if streamBody {
+			// Write the parts through a pipe while the request is sent
+			boundary := multipart.NewWriter(nil).Boundary()
+			openBody, replayable := streamMultipart(boundary, formParams, parts)
+			if stream, err = openBody(); err != nil {
 				return nil, err
 			}
-			_, err = part.Write(fileBytes)
-			if err != nil {
+			if replayable {
+				getBody = openBody
+			}
+			headerParams["Content-Type"] = "multipart/form-data; boundary=" + boundary
+		} else {
+			body = &bytes.Buffer{}
+			w := multipart.NewWriter(body)
+
+			if err = writeMultipart(w, formParams, parts); err != nil {
 				return nil, err
 			}
-		}
+			w.Close()
 
-		// Set the Boundary in the Content-Type
-		headerParams["Content-Type"] = w.FormDataContentType()
+			// Set the Boundary in the Content-Type
+			headerParams["Content-Type"] = w.FormDataContentType()
 
-		// Set Content-Length
-		headerParams["Content-Length"] = fmt.Sprintf("%d", body.Len())
-		w.Close()
+			// Set Content-Length
+			headerParams["Content-Length"] = fmt.Sprintf("%d", body.Len())
+		}
 	}
 
 	if strings.HasPrefix(headerParams["Content-Type"], "application/x-www-form-urlencoded") && len(formParams) > 0 {
-		if body != nil {
+		if body != nil || stream != nil {
 			return nil, errors.New("Cannot specify postBody and x-www-form-urlencoded form at the same time.")
 		}
 		body = &bytes.Buffer{}
@@ -254,35 +419,24 @@ func (c *APIClient) prepareRequest(
 	}
 
 	// Setup path and query parameters
-	url, err := url.Parse(path)
+	url, err := c.buildURL(path, queryParams)
 	if err != nil {
 		return nil, err
 	}
 
-	// Override request host, if applicable
-	if c.cfg.Host != "" {
-		url.Host = c.cfg.Host
-	}
-
-	// Override request scheme, if applicable
-	if c.cfg.Scheme != "" {
-		url.Scheme = c.cfg.Scheme
-	}
-
-	// Adding Query Param
-	query := url.Query()
-	for k, v := range queryParams {
-		for _, iv := range v {
-			query.Add(k, iv)
-		}
-	}
-
-	// Encode the parameters.
-	url.RawQuery = query.Encode()
-
 	// Generate a new request
 	if body != nil {
 		localVarRequest, err = http.NewRequest(method, url.String(), body)
+	} else if stream != nil {
+		localVarRequest, err = http.NewRequest(method, url.String(), stream)
+		if err == nil {
+			localVarRequest.GetBody = getBody
+			if contentLength >= 0 {
+				localVarRequest.ContentLength = contentLength
+			}
+		} else if closer, ok := stream.(io.Closer); ok {
+			closer.Close()
+		}
 	} else {
 		localVarRequest, err = http.NewRequest(method, url.String(), nil)
 	}
@@ -338,6 +492,36 @@ func (c *APIClient) prepareRequest(
 	return localVarRequest, nil
 }
 
+// buildURL parses the resolved path of a request, overrides its host and scheme and adds the query parameters
+func (c *APIClient) buildURL(path string, queryParams url.Values) (*url.URL, error) {
+	url, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Override request host, if applicable
+	if c.cfg.Host != "" {
+		url.Host = c.cfg.Host
+	}
+
+	// Override request scheme, if applicable
+	if c.cfg.Scheme != "" {
+		url.Scheme = c.cfg.Scheme
+	}
+
+	// Adding Query Param
+	query := url.Query()
+	for k, v := range queryParams {
+		for _, iv := range v {
+			query.Add(k, iv)
+		}
+	}
+
+	// Encode the parameters.
+	url.RawQuery = query.Encode()
+	return url, nil
+}
+
 func (c *APIClient) decode(v interface{}, b []byte, contentType string) (err error) {
 	if len(b) == 0 {
 		return nil
@@ -491,9 +675,15 @@ func strlen(s string) int {
 
 // GenericOpenAPIError Provides access to the body, error and model on returned errors.
 type GenericOpenAPIError struct {
-	body  []byte
-	error string
-	model interface{}
+	body       []byte
+	error      string
+	model      interface{}
+	statusCode int
+	header     http.Header
+	method     string
+	url        string
+	attempts   int
+	err        error
 }
 
 // Error returns non-empty string if there was an error.
@@ -510,3 +700,68 @@ func (e GenericOpenAPIError) Body() []byte {
 func (e GenericOpenAPIError) Model() interface{} {
 	return e.model
 }
+
+// StatusCode returns the status code of the response, 0 if there was no response
+func (e GenericOpenAPIError) StatusCode() int {
+	return e.statusCode
+}
+
+// Header returns the headers of the response
+func (e GenericOpenAPIError) Header() http.Header {
+	return e.header
+}
+
+// Method returns the method of the request
+func (e GenericOpenAPIError) Method() string {
+	return e.method
+}
+
+// URL returns the URL of the request
+func (e GenericOpenAPIError) URL() string {
+	return e.url
+}
+
+// Attempts returns the number of attempts made before giving up
+func (e GenericOpenAPIError) Attempts() int {
+	return e.attempts
+}
+
+// Unwrap returns the transport error of a call that got no response
+func (e GenericOpenAPIError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether the status code of the error matches a status sentinel such as ErrNotFound.
+func (e GenericOpenAPIError) Is(target error) bool {
+	if e.statusCode == 0 {
+		return false
+	}
+	return statusError(e.statusCode) == target
+}
+
+// newResponseError builds the error returned for a response.
+func newResponseError(resp *http.Response, body []byte, attempts int, message string) GenericOpenAPIError {
+	newErr := GenericOpenAPIError{
+		body:       body,
+		error:      message,
+		statusCode: resp.StatusCode,
+		header:     resp.Header,
+		attempts:   attempts,
+	}
+	if resp.Request != nil {
+		newErr.method = resp.Request.Method
+		newErr.url = resp.Request.URL.String()
+	}
+	return newErr
+}
+
+// newRequestError builds the error returned for a request that got no response.
+func newRequestError(req *http.Request, attempts int, err error) GenericOpenAPIError {
+	return GenericOpenAPIError{
+		error:    err.Error(),
+		method:   req.Method,
+		url:      req.URL.String(),
+		attempts: attempts,
+		err:      err,
+	}
+}
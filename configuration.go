@@ -29,6 +29,18 @@ var (
 
 	// ContextAPIKey takes an APIKey as authentication for the request
 	ContextAPIKey = contextKey("apikey")
+
+	// ContextServerIndex uses a server configuration from the index.
+	ContextServerIndex = contextKey("serverIndex")
+
+	// ContextOperationServerIndices uses a server configuration from the index mapping.
+	ContextOperationServerIndices = contextKey("serverOperationIndices")
+
+	// ContextServerVariables overrides a server configuration variables.
+	ContextServerVariables = contextKey("serverVariables")
+
+	// ContextOperationServerVariables overrides a server configuration variables using operation specific values.
+	ContextOperationServerVariables = contextKey("serverOperationVariables")
 )
 
 
@@ -42,6 +54,7 @@ type ServerVariable struct {
 
 // ServerConfiguration stores the information about a server
 type ServerConfiguration struct {
+	Name        string
 	Url         string
 	Description string
 	Variables   map[string]ServerVariable
@@ -56,7 +69,45 @@ type Configuration struct {
 	UserAgent     string            `json:"userAgent,omitempty"`
 	Debug         bool              `json:"debug,omitempty"`
 	Servers       []ServerConfiguration
-	HTTPClient    *http.Client
+	// OperationServers overrides Servers for the builders of an operation, see builder.Operation.
+	OperationServers map[string][]ServerConfiguration
+	HTTPClient       *http.Client
+	RetryPolicy      *RetryPolicy
+	// LoadBalancer spreads the calls across Servers when a builder does not choose one.
+	LoadBalancer *LoadBalancer
+	// CircuitBreaker fails the calls fast while a host or a route keeps failing.
+	CircuitBreaker *CircuitBreaker
+	// RateLimiter holds the calls until they fit the rate limits and the concurrency cap.
+	RateLimiter *RateLimiter
+	// Cache answers GET and HEAD requests with stored responses while they are fresh.
+	Cache *Cache
+	// DeduplicateGets shares a single upstream call between the identical GET calls in flight.
+	DeduplicateGets bool
+	// DeduplicateHeaders are the request headers telling GET calls apart, besides the method and
+	// the URL. When empty every header does. Headers set by request interceptors are not part of it.
+	DeduplicateHeaders []string
+
+	RequestInterceptors  []RequestInterceptor
+	ResponseInterceptors []ResponseInterceptor
+
+	// RedactHeaders are masked in the dumps of requests and responses.
+	RedactHeaders []string `json:"redactHeaders,omitempty"`
+
+	// Logger receives an entry per attempt and, in debug mode, the dumps of requests and responses.
+	// When it is nil, debug mode logs through the standard logger.
+	Logger Logger
+	// LogLevel is the lowest level of the entries sent to the logger.
+	LogLevel LogLevel `json:"logLevel,omitempty"`
+	// RedactBodyFields are JSON or form fields masked in the logged bodies.
+	RedactBodyFields []string `json:"redactBodyFields,omitempty"`
+	// MaxLogBodySize truncates the logged bodies longer than this many bytes, 0 means no limit.
+	MaxLogBodySize int `json:"maxLogBodySize,omitempty"`
+}
+
+// defaultServer is the placeholder server of a new configuration, replaced by the first added server
+var defaultServer = ServerConfiguration{
+	Url:         "http://localhost",
+	Description: "No description provided",
 }
 
 // NewConfiguration returns a new Configuration object
@@ -67,12 +118,10 @@ func NewConfiguration() *Configuration {
 		UserAgent:     "OpenAPI-Generator/1.0.0/go",
 		Debug:         false,
 		Servers: []ServerConfiguration{
-			{
-				Url:         "http://localhost",
-				Description: "No description provided",
-			},
+			defaultServer,
 		},
-		HTTPClient: http.DefaultClient,
+		HTTPClient:    http.DefaultClient,
+		RedactHeaders: append([]string(nil), DefaultRedactHeaders...),
 	}
 	return cfg
 }
@@ -101,12 +150,129 @@ func (c *Configuration) AddBasePath(basePath string) *Configuration{
 	return c
 }
 
+// AddRetryPolicy adds a retry policy used by every request of the builder
+func (c *Configuration) AddRetryPolicy(policy *RetryPolicy) *Configuration {
+	c.RetryPolicy = policy
+	return c
+}
+
+// AddRequestInterceptor adds interceptors run on every request before it is sent
+func (c *Configuration) AddRequestInterceptor(interceptors ...RequestInterceptor) *Configuration {
+	c.RequestInterceptors = append(c.RequestInterceptors, interceptors...)
+	return c
+}
+
+// AddResponseInterceptor adds interceptors run on every response before it is decoded
+func (c *Configuration) AddResponseInterceptor(interceptors ...ResponseInterceptor) *Configuration {
+	c.ResponseInterceptors = append(c.ResponseInterceptors, interceptors...)
+	return c
+}
+
+// AddRedactHeader adds headers masked in the dumps of requests and responses
+func (c *Configuration) AddRedactHeader(headers ...string) *Configuration {
+	c.RedactHeaders = append(c.RedactHeaders, headers...)
+	return c
+}
+
+// AddLogger adds a structured logger logging entries of at least the given level
+func (c *Configuration) AddLogger(logger Logger, level LogLevel) *Configuration {
+	c.Logger, c.LogLevel = logger, level
+	return c
+}
+
+// AddRedactBodyField adds JSON or form fields masked in the logged bodies
+func (c *Configuration) AddRedactBodyField(fields ...string) *Configuration {
+	c.RedactBodyFields = append(c.RedactBodyFields, fields...)
+	return c
+}
+
+// AddServer adds a server configuration, chosen by index or by name.
+// The first server added replaces the placeholder server of NewConfiguration
+func (c *Configuration) AddServer(server ServerConfiguration) *Configuration {
+	if len(c.Servers) == 1 && isDefaultServer(c.Servers[0]) {
+		c.Servers = nil
+	}
+	c.Servers = append(c.Servers, server)
+	return c
+}
+
+// isDefaultServer reports whether a server is the placeholder server of NewConfiguration
+func isDefaultServer(server ServerConfiguration) bool {
+	return server.Url == defaultServer.Url && server.Description == defaultServer.Description &&
+		server.Name == "" && len(server.Variables) == 0
+}
+
+// AddOperationServer adds a server configuration used by the builders of an operation
+func (c *Configuration) AddOperationServer(operation string, server ServerConfiguration) *Configuration {
+	if c.OperationServers == nil {
+		c.OperationServers = make(map[string][]ServerConfiguration)
+	}
+	c.OperationServers[operation] = append(c.OperationServers[operation], server)
+	return c
+}
+
+// AddLoadBalancer adds a load balancer spreading the calls across the servers
+func (c *Configuration) AddLoadBalancer(balancer *LoadBalancer) *Configuration {
+	c.LoadBalancer = balancer
+	return c
+}
+
+// AddCircuitBreaker adds a circuit breaker failing the calls fast while a host or a route keeps failing
+func (c *Configuration) AddCircuitBreaker(breaker *CircuitBreaker) *Configuration {
+	c.CircuitBreaker = breaker
+	return c
+}
+
+// AddRateLimiter adds a rate limiter holding the calls until they fit the rate limits and the concurrency cap
+func (c *Configuration) AddRateLimiter(limiter *RateLimiter) *Configuration {
+	c.RateLimiter = limiter
+	return c
+}
+
+// AddCache adds an HTTP cache answering GET and HEAD requests with stored responses
+func (c *Configuration) AddCache(cache *Cache) *Configuration {
+	c.Cache = cache
+	return c
+}
+
+// AddDeduplication shares a single upstream call between the identical GET calls in flight,
+// told apart by their method, URL and the given headers, or all their headers when none is given
+func (c *Configuration) AddDeduplication(headers ...string) *Configuration {
+	c.DeduplicateGets = true
+	c.DeduplicateHeaders = append(c.DeduplicateHeaders, headers...)
+	return c
+}
+
 // ServerUrl returns URL based on server settings
 func (c *Configuration) ServerUrl(index int, variables map[string]string) (string, error) {
-	if index < 0 || len(c.Servers) <= index {
-		return "", fmt.Errorf("Index %v out of range %v", index, len(c.Servers)-1)
+	return serverUrl(c.Servers, index, variables)
+}
+
+// ServerUrlByName returns URL based on the settings of the server with the given name
+func (c *Configuration) ServerUrlByName(name string, variables map[string]string) (string, error) {
+	index, err := serverIndex(c.Servers, name)
+	if err != nil {
+		return "", err
+	}
+	return serverUrl(c.Servers, index, variables)
+}
+
+// serverIndex returns the index of the server with the given name
+func serverIndex(servers []ServerConfiguration, name string) (int, error) {
+	for i, server := range servers {
+		if server.Name == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("Server %s not found", name)
+}
+
+// serverUrl returns URL based on the settings of one of the servers
+func serverUrl(servers []ServerConfiguration, index int, variables map[string]string) (string, error) {
+	if index < 0 || len(servers) <= index {
+		return "", fmt.Errorf("Index %v out of range %v", index, len(servers)-1)
 	}
-	server := c.Servers[index]
+	server := servers[index]
 	url := server.Url
 
 	// go through variables and replace placeholders
@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Deduplicate shares a single upstream call between this GET call and the identical ones in
+// flight, as Configuration.DeduplicateGets does for every GET call.
+func (b *builder) Deduplicate() *builder {
+	b.deduplicate = true
+	return b
+}
+
+// flightGroup runs a single upstream call per key at a time, shared by every caller asking
+// for the same key meanwhile.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a call in progress and, once done, its outcome.
+type flight struct {
+	done     chan struct{}
+	cancel   context.CancelFunc
+	waiters  int
+	resp     *http.Response
+	body     []byte
+	attempts int
+	err      error
+}
+
+// do returns the outcome of the call of key, starting it with fn when none is in flight. The
+// call runs on a context detached from the callers, which is canceled once every caller has
+// given up. A caller gives up when its own context is done.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (*http.Response, int, error)) (*flight, bool, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	f, shared := g.calls[key]
+	if !shared {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = f
+		go g.run(callCtx, key, f, fn)
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f, shared, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if g.calls[key] == f {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
+
+// run makes the call of a flight and reads its whole response body.
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(ctx context.Context) (*http.Response, int, error)) {
+	defer f.cancel()
+
+	f.resp, f.attempts, f.err = fn(ctx)
+	if f.resp != nil && f.resp.Body != nil {
+		body, err := ioutil.ReadAll(f.resp.Body)
+		f.resp.Body.Close()
+		if f.err == nil {
+			f.err = err
+		}
+		f.body = body
+	}
+
+	g.mu.Lock()
+	if g.calls[key] == f {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// response returns a copy of the response of the flight for the request of one of its callers.
+func (f *flight) response(req *http.Request) *http.Response {
+	if f.resp == nil {
+		return nil
+	}
+	resp := *f.resp
+	resp.Request = req
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(f.body))
+	return &resp
+}
+
+// flightKey returns the key telling GET calls apart: the method, the URL and the headers of the
+// request, or only the given headers when there are some.
+func flightKey(req *http.Request, headers []string) string {
+	var key strings.Builder
+	key.WriteString(req.Method)
+	key.WriteString(" ")
+	key.WriteString(req.URL.String())
+
+	if len(headers) == 0 {
+		for name := range req.Header {
+			headers = append(headers, name)
+		}
+		sort.Strings(headers)
+	}
+	for _, name := range headers {
+		key.WriteString("\n")
+		key.WriteString(http.CanonicalHeaderKey(name))
+		key.WriteString(": ")
+		key.WriteString(strings.Join(req.Header.Values(name), ", "))
+	}
+	return key.String()
+}
+
+// sendShared sends a GET request, or joins the identical one in flight, and gives every caller
+// a response of its own, whose body reads the shared one. Requests are told apart as they are
+// prepared: the headers set by the request interceptors are not part of the key.
+func (c *APIClient) sendShared(request *http.Request, opts callOptions) (*http.Response, int, error) {
+	key := flightKey(request, c.cfg.DeduplicateHeaders)
+	f, shared, err := c.flights.do(request.Context(), key, func(ctx context.Context) (*http.Response, int, error) {
+		return c.send(request.WithContext(ctx), opts)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if shared {
+		c.log(request.Context(), LogLevelDebug, "joined a call in flight", LogField{Key: "url", Value: request.URL.String()})
+	}
+	return f.response(request), f.attempts, f.err
+}
@@ -0,0 +1,158 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplication(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"` + r.Header.Get("X-Tenant") + `"}`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddDeduplication("X-Tenant"))
+	waitHits := func(expected int32) {
+		t.Helper()
+		for i := 0; i < 100 && atomic.LoadInt32(&hits) < expected; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := atomic.LoadInt32(&hits); n != expected {
+			t.Fatalf("%d hits, expected %d", n, expected)
+		}
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]PostResponse, 10)
+	for i := range responses {
+		tenant := "a"
+		if i%2 == 1 {
+			tenant = "b"
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := apiClient.Builder("/country").SetHeader("X-Tenant", tenant).SetHeader("X-Request-Id", i).Call(context.Background(), &responses[i])
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	waitHits(2)
+	// let the other calls join the ones in flight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("%d hits, expected 2", n)
+	}
+	for i, response := range responses {
+		if expected := map[bool]string{true: "a", false: "b"}[i%2 == 0]; response.Message != expected {
+			t.Errorf("response %d: %q, expected %q", i, response.Message, expected)
+		}
+	}
+
+	// a caller gives up on its own
+	atomic.StoreInt32(&hits, 0)
+	release = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		var response PostResponse
+		_, err := apiClient.Builder("/country").Call(ctx, &response)
+		done <- err
+	}()
+	var response PostResponse
+	go func() {
+		_, err := apiClient.Builder("/country").Call(context.Background(), &response)
+		done <- err
+	}()
+	waitHits(1)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller: %v, expected context.Canceled", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("other caller: %v", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("%d hits, expected 1", n)
+	}
+}
+
+func TestDeduplicationInterceptors(t *testing.T) {
+	var hits, runs int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":"` + r.Header.Get("X-Tenant") + `"}`))
+	}))
+	defer server.Close()
+
+	cfg := NewConfiguration().
+		AddBasePath(server.URL).
+		AddDeduplication().
+		AddRequestInterceptor(func(r *http.Request) error {
+			r.Header.Set("X-Request-Id", strconv.Itoa(int(atomic.AddInt32(&runs, 1))))
+			return nil
+		})
+	apiClient := NewAPIClient(cfg)
+
+	// a header set by the interceptors of the configuration does not tell calls apart
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := apiClient.Builder("/country").Call(context.Background(), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&hits) < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.SwapInt32(&hits, 0); n != 1 {
+		t.Errorf("%d hits, expected 1", n)
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("interceptors ran %d times, expected 1", n)
+	}
+
+	// a builder with its own interceptors is sent on its own
+	for _, tenant := range []string{"a", "b"} {
+		tenant := tenant
+		var response PostResponse
+		_, err := apiClient.Builder("/country").
+			AddRequestInterceptor(func(r *http.Request) error {
+				r.Header.Set("X-Tenant", tenant)
+				return nil
+			}).
+			Call(context.Background(), &response)
+		if err != nil || response.Message != tenant {
+			t.Errorf("tenant %s got the response of %q: %v", tenant, response.Message, err)
+		}
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("%d hits, expected 2", n)
+	}
+}
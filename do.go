@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Do sends the request built by b and decodes a successful response body into a value of type T.
+// The fields of T tagged with the "header" option are set from the response header.
+func Do[T any](ctx context.Context, b *builder) (T, *http.Response, error) {
+	var result T
+
+	localVarHTTPResponse, localVarBody, attempts, err := b.execute(ctx)
+	if err != nil {
+		return result, localVarHTTPResponse, err
+	}
+
+	// A response to HEAD has no body to decode
+	if b.localVarHTTPMethod != http.MethodHead {
+		err = b.a.client.decode(&result, localVarBody, localVarHTTPResponse.Header.Get("Content-Type"))
+		if err != nil {
+			newErr := newResponseError(localVarHTTPResponse, localVarBody, attempts, err.Error())
+			return result, localVarHTTPResponse, newErr
+		}
+	}
+
+	return result, localVarHTTPResponse, decodeHeader(&result, localVarHTTPResponse, localVarBody, attempts)
+}
+
+// DoWithError is the same as Do, but decodes the body of a response with a status code of 300
+// or more into a value of type E. That value is the model of the returned GenericOpenAPIError,
+// use ErrorModel to get it back.
+func DoWithError[T, E any](ctx context.Context, b *builder) (T, *http.Response, error) {
+	result, localVarHTTPResponse, err := Do[T](ctx, b)
+	if err == nil || localVarHTTPResponse == nil || localVarHTTPResponse.StatusCode < 300 {
+		return result, localVarHTTPResponse, err
+	}
+
+	var apiErr GenericOpenAPIError
+	if !errors.As(err, &apiErr) {
+		return result, localVarHTTPResponse, err
+	}
+
+	var model E
+	if decodeErr := b.a.client.decode(&model, apiErr.body, localVarHTTPResponse.Header.Get("Content-Type")); decodeErr == nil {
+		apiErr.model = model
+	}
+	return result, localVarHTTPResponse, apiErr
+}
+
+// ErrorModel returns the model of type E carried by a GenericOpenAPIError in err's chain.
+func ErrorModel[E any](err error) (E, bool) {
+	var apiErr GenericOpenAPIError
+	if errors.As(err, &apiErr) {
+		model, ok := apiErr.model.(E)
+		return model, ok
+	}
+	var zero E
+	return zero, false
+}
@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+)
+
+// DefaultRedactHeaders are the headers masked in dumps of requests and responses.
+var DefaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"X-API-Key",
+	"Cookie",
+	"Set-Cookie",
+}
+
+const redactedValue = "[REDACTED]"
+
+// redactDump masks the values of the given headers in the wire format dump of a request or a response.
+func redactDump(dump []byte, headers []string) []byte {
+	if len(headers) == 0 {
+		return dump
+	}
+
+	end := bytes.Index(dump, []byte("\r\n\r\n"))
+	if end < 0 {
+		end = len(dump)
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(dump))
+	lines := bytes.Split(dump[:end], []byte("\r\n"))
+	for i, line := range lines {
+		if i > 0 {
+			out.WriteString("\r\n")
+		}
+		colon := bytes.IndexByte(line, ':')
+		if i > 0 && colon > 0 && containsHeader(headers, string(line[:colon])) {
+			out.Write(line[:colon])
+			out.WriteString(": " + redactedValue)
+			continue
+		}
+		out.Write(line)
+	}
+	out.Write(dump[end:])
+	return out.Bytes()
+}
+
+// containsHeader reports whether name is one of headers, ignoring case.
+func containsHeader(headers []string, name string) bool {
+	name = http.CanonicalHeaderKey(name)
+	for _, header := range headers {
+		if http.CanonicalHeaderKey(header) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpResponse returns the wire format of a response with at most limit bytes of its body,
+// or all of it when limit is 0, or none of it without body. The body is left for the caller
+// to read in full. It also returns the number of bytes of the body left out of the dump,
+// -1 when it is unknown.
+func dumpResponse(resp *http.Response, body bool, limit int) ([]byte, int64, error) {
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody || resp.ContentLength == 0 {
+		return dump, 0, err
+	}
+	if !body {
+		return dump, resp.ContentLength, nil
+	}
+
+	reader := io.Reader(resp.Body)
+	if limit > 0 {
+		reader = io.LimitReader(resp.Body, int64(limit)+1)
+	}
+	peek, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peek), resp.Body), Closer: resp.Body}
+
+	var rest int64
+	if limit > 0 && len(peek) > limit {
+		rest = -1
+		if resp.ContentLength > 0 {
+			rest = resp.ContentLength - int64(limit)
+		}
+		peek = peek[:limit]
+	}
+	return append(dump, peek...), rest, nil
+}
+
+// peekedBody is a response body whose first bytes were read ahead.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// Sentinel errors matched by a GenericOpenAPIError with errors.Is, based on its status code.
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrServerError     = errors.New("server error")
+)
+
+// statusError returns the sentinel error of a status code, nil if there is none.
+func statusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	}
+	if statusCode >= 500 {
+		return ErrServerError
+	}
+	return nil
+}
+
+// decodeErrorModel decodes body into a new value of the same type as the registered model.
+func (c *APIClient) decodeErrorModel(prototype interface{}, body []byte, contentType string) (interface{}, error) {
+	t := reflect.TypeOf(prototype)
+	isPtr := t.Kind() == reflect.Ptr
+	if isPtr {
+		t = t.Elem()
+	}
+	v := reflect.New(t)
+	if err := c.decode(v.Interface(), body, contentType); err != nil {
+		return nil, err
+	}
+	if isPtr {
+		return v.Interface(), nil
+	}
+	return v.Elem().Interface(), nil
+}
@@ -1,5 +1,7 @@
 module github.com/phuc1998/http-builder
 
-go 1.13
+go 1.21
 
 require golang.org/x/oauth2 v0.0.0-20210402161424-2e8d93401602
+
+require golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
@@ -1,12 +1,14 @@
 package builder
 
 import (
+	"bytes"
 	_context "context"
+	"errors"
 	"fmt"
 	_ioutil "io/ioutil"
 	_nethttp "net/http"
 	_neturl "net/url"
-	"strings"
+	"reflect"
 
 	"github.com/phuc1998/http-builder/structs"
 )
@@ -33,6 +35,37 @@ type builder struct {
 	localVarFormParams       _neturl.Values
 	localVarHTTPContentTypes []string
 	dumpRequestOut           *string
+	retryPolicy              *RetryPolicy
+	requestInterceptors      []RequestInterceptor
+	responseInterceptors     []ResponseInterceptor
+	errorModels              map[int]interface{}
+	streamBody               bool
+	contentLength            int64
+	parts                    []formPart
+	errs                     []error
+	invalidFields            []FieldError
+	pathParams               map[string]pathParam
+	serverIndex              int
+	serverName               string
+	serverVariables          map[string]string
+	operation                string
+	captureRequest           *bytes.Buffer
+	captureResponse          *bytes.Buffer
+	deduplicate              bool
+}
+
+// callOptions carries the settings of a single call, merged from the configuration and the builder.
+type callOptions struct {
+	retryPolicy          *RetryPolicy
+	requestInterceptors  []RequestInterceptor
+	responseInterceptors []ResponseInterceptor
+	dumpRequestOut       *string
+	captureRequest       *bytes.Buffer
+	captureResponse      *bytes.Buffer
+	streamBody           bool
+	streamResponse       bool
+	balanced             *balancedTarget
+	route                string
 }
 
 func (a *service) Builder(uri string, acceptHeader ...string) *builder {
@@ -44,6 +77,8 @@ func (a *service) Builder(uri string, acceptHeader ...string) *builder {
 	bd.a, bd.uri = a, uri
 	bd.localVarHTTPMethod = _nethttp.MethodGet
 	bd.localVarHeaderParams = make(map[string]string)
+	bd.contentLength = -1
+	bd.serverIndex = -1
 	return bd
 }
 
@@ -67,6 +102,27 @@ func (b *builder) Delete() *builder {
 	return b
 }
 
+func (b *builder) Patch() *builder {
+	b.localVarHTTPMethod = _nethttp.MethodPatch
+	return b
+}
+
+func (b *builder) Head() *builder {
+	b.localVarHTTPMethod = _nethttp.MethodHead
+	return b
+}
+
+func (b *builder) Options() *builder {
+	b.localVarHTTPMethod = _nethttp.MethodOptions
+	return b
+}
+
+// Method sets any HTTP method, such as the WebDAV PROPFIND
+func (b *builder) Method(method string) *builder {
+	b.localVarHTTPMethod = method
+	return b
+}
+
 func (b *builder) SetBody(body interface{}) *builder {
 	b.localVarPostBody = body
 	return b
@@ -97,8 +153,15 @@ func (b *builder) SetContentType(contentType string) *builder {
 	return b
 }
 
+// SetPath sets the value of the :key or {key} placeholder, escaped as a path segment
 func (b *builder) SetPath(key string, value interface{}) *builder {
-	b.uri = strings.ReplaceAll(b.uri, fmt.Sprintf(":%s", key), parameterToString(value, ""))
+	b.setPath(key, parameterToString(value, ""), false)
+	return b
+}
+
+// SetRawPath sets the value of the :key or {key} placeholder, inserted without escaping
+func (b *builder) SetRawPath(key string, value string) *builder {
+	b.setPath(key, value, true)
 	return b
 }
 
@@ -117,13 +180,29 @@ func (b *builder) SetFileBytes(files []byte) *builder {
 	return b
 }
 
+// SetQuery adds a query parameter, repeating the key for each element of a slice
 func (b *builder) SetQuery(key string, value interface{}) *builder {
-	b.localVarQueryParams.Add(key, parameterToString(value, ""))
+	b.addError(addValue(b.localVarQueryParams, key, value, "", nil))
 	return b
 }
 
+// SetQueryCollection adds a query parameter, joining the elements of a slice
+// in the collection format: csv, ssv, tsv, pipes or multi (repeated keys)
+func (b *builder) SetQueryCollection(key string, value interface{}, collectionFormat string) *builder {
+	b.addError(addValue(b.localVarQueryParams, key, value, collectionFormat, nil))
+	return b
+}
+
+// SetFormParam adds a form parameter, repeating the key for each element of a slice
 func (b *builder) SetFormParam(key string, value interface{}) *builder {
-	b.localVarFormParams.Add(key, parameterToString(value, ""))
+	b.addError(addValue(b.localVarFormParams, key, value, "", nil))
+	return b
+}
+
+// SetFormParamCollection adds a form parameter, joining the elements of a slice
+// in the collection format: csv, ssv, tsv, pipes or multi (repeated keys)
+func (b *builder) SetFormParamCollection(key string, value interface{}, collectionFormat string) *builder {
+	b.addError(addValue(b.localVarFormParams, key, value, collectionFormat, nil))
 	return b
 }
 
@@ -132,32 +211,34 @@ func (b *builder) BuildQuery(queryObject interface{}) *builder {
 		structField = structs.Map(queryObject)
 		queryMap    = structField["_query_"]
 	)
+	b.validate(queryObject)
 	if queryMap != nil {
 		for key, value := range queryMap.(map[string]interface{}) {
-			b.localVarQueryParams.Add(key, parameterToString(value, ""))
+			b.addParam(b.localVarQueryParams, key, value)
 		}
 		return b
 	}
 	for key, value := range structField {
-		b.localVarQueryParams.Add(key, parameterToString(value, ""))
+		b.addParam(b.localVarQueryParams, key, value)
 	}
 	return b
 }
 
-//BuildPath Replace :key by value
+//BuildPath Replace :key or {key} by value
 func (b *builder) BuildPath(pathObject interface{}) *builder {
 	var (
 		structField = structs.Map(pathObject)
 		pathMap     = structField["_path_"]
 	)
+	b.validate(pathObject)
 	if pathMap != nil {
 		for key, value := range pathMap.(map[string]interface{}) {
-			b.uri = strings.ReplaceAll(b.uri, fmt.Sprintf(":%s", key), parameterToString(value, ""))
+			b.setPathParam(key, value)
 		}
 		return b
 	}
 	for key, value := range structField {
-		b.uri = strings.ReplaceAll(b.uri, fmt.Sprintf(":%s", key), parameterToString(value, ""))
+		b.setPathParam(key, value)
 	}
 	return b
 }
@@ -166,15 +247,22 @@ func (b *builder) BuildHeader(headerObject interface{}) *builder {
 	var (
 		structField = structs.Map(headerObject)
 		headerMap   = structField["_header_"]
+		authMap     = structField["_auth_"]
 	)
+	b.validate(headerObject)
+	if authMap != nil {
+		b.buildAuth(authMap.(map[string]interface{}))
+	}
 	if headerMap != nil {
 		for key, value := range headerMap.(map[string]interface{}) {
-			b.localVarHeaderParams[key] = parameterToString(value, "")
+			b.setHeaderParam(key, value)
 		}
+	}
+	if headerMap != nil || authMap != nil {
 		return b
 	}
 	for key, value := range structField {
-		b.localVarHeaderParams[key] = parameterToString(value, "")
+		b.setHeaderParam(key, value)
 	}
 	return b
 }
@@ -184,19 +272,20 @@ func (b *builder) BuildForm(formObject interface{}) *builder {
 		structField = structs.Map(formObject)
 		formMap     = structField["_form_"]
 	)
+	b.validate(formObject)
 	if formMap != nil {
 		for key, value := range formMap.(map[string]interface{}) {
-			b.localVarFormParams.Add(key, parameterToString(value, ""))
+			b.addParam(b.localVarFormParams, key, value)
 		}
 		return b
 	}
 	for key, value := range structField {
-		b.localVarFormParams.Add(key, parameterToString(value, ""))
+		b.addParam(b.localVarFormParams, key, value)
 	}
 	return b
 }
 
-//BuildRequest default base on http tag, not support build body
+//BuildRequest default base on http tag, the fields tagged body are the request body
 func (b *builder) BuildRequest(request interface{}) *builder {
 	var (
 		structField = structs.Map(request)
@@ -204,27 +293,36 @@ func (b *builder) BuildRequest(request interface{}) *builder {
 		queryMap    = structField["_query_"]
 		pathMap     = structField["_path_"]
 		formMap     = structField["_form_"]
+		body        = structField["_body_"]
+		authMap     = structField["_auth_"]
 	)
+	b.validate(request)
 	if headerMap != nil {
 		for key, value := range headerMap.(map[string]interface{}) {
-			b.localVarHeaderParams[key] = parameterToString(value, "")
+			b.setHeaderParam(key, value)
 		}
 	}
 	if queryMap != nil {
 		for key, value := range queryMap.(map[string]interface{}) {
-			b.localVarQueryParams.Add(key, parameterToString(value, ""))
+			b.addParam(b.localVarQueryParams, key, value)
 		}
 	}
 	if pathMap != nil {
 		for key, value := range pathMap.(map[string]interface{}) {
-			b.uri = strings.ReplaceAll(b.uri, fmt.Sprintf(":%s", key), parameterToString(value, ""))
+			b.setPathParam(key, value)
 		}
 	}
 	if formMap != nil {
 		for key, value := range formMap.(map[string]interface{}) {
-			b.localVarFormParams.Add(key, parameterToString(value, ""))
+			b.addParam(b.localVarFormParams, key, value)
 		}
 	}
+	if body != nil {
+		b.localVarPostBody = body
+	}
+	if authMap != nil {
+		b.buildAuth(authMap.(map[string]interface{}))
+	}
 	return b
 }
 
@@ -248,15 +346,112 @@ func (b *builder) UseApplicationXML() *builder {
 	return b
 }
 
+// StreamRequestBody sends an io.Reader body and multipart forms as they are read instead of
+// buffering them in memory. A body set as a func() (io.ReadCloser, error) is called again
+// to replay it on redirects and retries, as is a body implementing io.Seeker.
+func (b *builder) StreamRequestBody() *builder {
+	b.streamBody = true
+	return b
+}
+
+// SetContentLength sets the length of a streamed body when it cannot be detected.
+func (b *builder) SetContentLength(contentLength int64) *builder {
+	b.contentLength = contentLength
+	return b
+}
+
+// SetRetryPolicy overrides the retry policy of the configuration for this request
+func (b *builder) SetRetryPolicy(policy *RetryPolicy) *builder {
+	b.retryPolicy = policy
+	return b
+}
+
+// AddRequestInterceptor adds interceptors run after the ones of the configuration
+func (b *builder) AddRequestInterceptor(interceptors ...RequestInterceptor) *builder {
+	b.requestInterceptors = append(b.requestInterceptors, interceptors...)
+	return b
+}
+
+// AddResponseInterceptor adds interceptors run after the ones of the configuration
+func (b *builder) AddResponseInterceptor(interceptors ...ResponseInterceptor) *builder {
+	b.responseInterceptors = append(b.responseInterceptors, interceptors...)
+	return b
+}
+
+// OnStatus registers the model the body of a response with this status code is decoded into.
+// The decoded model is available from the Model method of the returned GenericOpenAPIError.
+func (b *builder) OnStatus(statusCode int, model interface{}) *builder {
+	if b.errorModels == nil {
+		b.errorModels = make(map[int]interface{})
+	}
+	b.errorModels[statusCode] = model
+	return b
+}
+
+// DumbOutRequest fills requestString with the wire format of the outgoing request,
+// with the headers listed in Configuration.RedactHeaders masked.
 func (b *builder) DumbOutRequest(requestString *string) *builder {
-	dumpString := ""
-	b.dumpRequestOut = &dumpString
-	requestString = b.dumpRequestOut
+	b.dumpRequestOut = requestString
 	return b
 }
 
-func (b *builder) Call(ctx _context.Context, response interface{}, parserCustom ...ParserCustomHandle) (*_nethttp.Response, error) {
-	localVarPath := b.a.client.cfg.BasePath + b.uri
+// CaptureTraffic fills the buffers with the wire format of the outgoing request and of the response,
+// with the headers listed in Configuration.RedactHeaders masked. Either buffer can be nil.
+// When the request is retried, the buffers hold the last attempt. The response body is cut to
+// Configuration.MaxLogBodySize bytes, and left out of the dump of a streamed response.
+func (b *builder) CaptureTraffic(request *bytes.Buffer, response *bytes.Buffer) *builder {
+	b.captureRequest, b.captureResponse = request, response
+	return b
+}
+
+func (b *builder) callOptions() callOptions {
+	cfg := b.a.client.cfg
+	opts := callOptions{
+		retryPolicy:     cfg.RetryPolicy,
+		dumpRequestOut:  b.dumpRequestOut,
+		captureRequest:  b.captureRequest,
+		captureResponse: b.captureResponse,
+		streamBody:      b.streamBody,
+		route:           b.uri,
+	}
+	if b.retryPolicy != nil {
+		opts.retryPolicy = b.retryPolicy
+	}
+	opts.requestInterceptors = append(opts.requestInterceptors, cfg.RequestInterceptors...)
+	opts.requestInterceptors = append(opts.requestInterceptors, b.requestInterceptors...)
+	opts.responseInterceptors = append(opts.responseInterceptors, cfg.ResponseInterceptors...)
+	opts.responseInterceptors = append(opts.responseInterceptors, b.responseInterceptors...)
+	return opts
+}
+
+// shared reports whether the call can share its upstream call with the identical ones in flight.
+// Calls capturing their request or response, or with their own request interceptors, retry policy
+// or server, are always sent on their own: only the options of the first call are used.
+func (b *builder) shared() bool {
+	return (b.deduplicate || b.a.client.cfg.DeduplicateGets) && b.localVarHTTPMethod == _nethttp.MethodGet &&
+		b.dumpRequestOut == nil && b.captureRequest == nil && b.captureResponse == nil &&
+		len(b.requestInterceptors) == 0 && b.retryPolicy == nil && b.serverIndex < 0 && b.serverName == ""
+}
+
+// open sends the request and returns the response with its body still open,
+// along with the number of attempts and the options of the call.
+// With stream the response body is left to the caller and never dumped, otherwise the call
+// joins the identical one in flight, if any.
+func (b *builder) open(ctx _context.Context, stream bool) (*_nethttp.Response, int, callOptions, error) {
+	// Nothing is sent when the request could not be built
+	var errs []error
+	if len(b.invalidFields) > 0 {
+		errs = append(errs, &ValidationError{Fields: b.invalidFields})
+	}
+	errs = append(errs, b.errs...)
+	localVarPath, target, err := b.requestURL(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, 0, callOptions{}, errors.Join(errs...)
+	}
+
 	localVarHTTPContentType := selectHeaderContentType(b.localVarHTTPContentTypes)
 	if localVarHTTPContentType != "" {
 		b.localVarHeaderParams["Content-Type"] = localVarHTTPContentType
@@ -268,51 +463,115 @@ func (b *builder) Call(ctx _context.Context, response interface{}, parserCustom
 		b.localVarHeaderParams["Accept"] = localVarHTTPHeaderAccept
 	}
 
-	r, err := b.a.client.prepareRequest(ctx, localVarPath, b.localVarHTTPMethod, b.localVarPostBody, b.localVarHeaderParams, b.localVarQueryParams, b.localVarFormParams, b.localVarFormFileName, b.localVarFileName, b.localVarFileBytes)
+	opts := b.callOptions()
+	opts.balanced = target
+	opts.streamResponse = stream
+	r, err := b.a.client.prepareRequest(ctx, localVarPath, b.localVarHTTPMethod, b.localVarPostBody, b.localVarHeaderParams, b.localVarQueryParams, b.localVarFormParams, b.multipartParts(), b.streamBody, b.contentLength)
 	if err != nil {
-		return nil, err
+		return nil, 0, opts, err
 	}
 
-	localVarHTTPResponse, err := b.a.client.callAPI(r, b.dumpRequestOut)
+	var (
+		localVarHTTPResponse *_nethttp.Response
+		attempts             int
+	)
+	if !stream && b.shared() {
+		localVarHTTPResponse, attempts, err = b.a.client.sendShared(r, opts)
+	} else {
+		localVarHTTPResponse, attempts, err = b.a.client.send(r, opts)
+	}
+	if err != nil && localVarHTTPResponse == nil {
+		err = newRequestError(r, attempts, err)
+	} else if err != nil && localVarHTTPResponse.Body != nil {
+		// Nobody reads the body of a failed call, close it to free its connection and its slot
+		localVarHTTPResponse.Body.Close()
+	}
+	return localVarHTTPResponse, attempts, opts, err
+}
 
+// execute sends the request and reads the whole response body, also returning the number of attempts.
+// A response with a status code of 300 or more is returned along with a GenericOpenAPIError.
+func (b *builder) execute(ctx _context.Context) (*_nethttp.Response, []byte, int, error) {
+	localVarHTTPResponse, attempts, opts, err := b.open(ctx, false)
 	if err != nil || localVarHTTPResponse == nil {
-		return localVarHTTPResponse, err
+		return localVarHTTPResponse, nil, attempts, err
 	}
+	localVarHTTPResponse, localVarBody, err := b.readResponse(localVarHTTPResponse, attempts, opts)
+	return localVarHTTPResponse, localVarBody, attempts, err
+}
 
+// readResponse reads and closes the response body, runs the response interceptors
+// and turns a status code of 300 or more into a GenericOpenAPIError.
+func (b *builder) readResponse(localVarHTTPResponse *_nethttp.Response, attempts int, opts callOptions) (*_nethttp.Response, []byte, error) {
 	localVarBody, err := _ioutil.ReadAll(localVarHTTPResponse.Body)
 	localVarHTTPResponse.Body.Close()
 	if err != nil {
-		return localVarHTTPResponse, err
+		return localVarHTTPResponse, nil, err
+	}
+
+	if err = interceptResponse(localVarHTTPResponse, localVarBody, opts.responseInterceptors); err != nil {
+		return localVarHTTPResponse, localVarBody, err
 	}
 
 	if localVarHTTPResponse.StatusCode >= 300 {
-		newErr := GenericOpenAPIError{
-			body:  localVarBody,
-			error: localVarHTTPResponse.Status,
+		newErr := newResponseError(localVarHTTPResponse, localVarBody, attempts, localVarHTTPResponse.Status)
+		if prototype, ok := b.errorModels[localVarHTTPResponse.StatusCode]; ok {
+			model, err := b.a.client.decodeErrorModel(prototype, localVarBody, localVarHTTPResponse.Header.Get("Content-Type"))
+			if err == nil {
+				newErr.model = model
+			}
 		}
-		return localVarHTTPResponse, newErr
+		return localVarHTTPResponse, localVarBody, newErr
+	}
+
+	return localVarHTTPResponse, localVarBody, nil
+}
+
+func (b *builder) Call(ctx _context.Context, response interface{}, parserCustom ...ParserCustomHandle) (*_nethttp.Response, error) {
+	localVarHTTPResponse, localVarBody, attempts, err := b.execute(ctx)
+	if err != nil {
+		return localVarHTTPResponse, err
+	}
+
+	// A response to HEAD has no body to decode
+	if b.localVarHTTPMethod == _nethttp.MethodHead {
+		return localVarHTTPResponse, decodeHeader(response, localVarHTTPResponse, localVarBody, attempts)
 	}
 
 	if len(parserCustom) > 0 {
 		err = parserCustom[0](response, localVarBody)
 		if err != nil {
-			newErr := GenericOpenAPIError{
-				body:  localVarBody,
-				error: err.Error(),
-			}
+			newErr := newResponseError(localVarHTTPResponse, localVarBody, attempts, err.Error())
 			return localVarHTTPResponse, newErr
 		}
-		return localVarHTTPResponse, nil
+		return localVarHTTPResponse, decodeHeader(response, localVarHTTPResponse, localVarBody, attempts)
 	}
 
 	err = b.a.client.decode(&response, localVarBody, localVarHTTPResponse.Header.Get("Content-Type"))
 	if err != nil {
-		newErr := GenericOpenAPIError{
-			body:  localVarBody,
-			error: err.Error(),
-		}
+		newErr := newResponseError(localVarHTTPResponse, localVarBody, attempts, err.Error())
 		return localVarHTTPResponse, newErr
 	}
 
-	return localVarHTTPResponse, nil
+	return localVarHTTPResponse, decodeHeader(response, localVarHTTPResponse, localVarBody, attempts)
+}
+
+// decodeHeader sets the fields of response tagged with the "header" option from the
+// response header. Anything but a pointer to a struct is left untouched.
+func decodeHeader(response interface{}, resp *_nethttp.Response, body []byte, attempts int) error {
+	v := reflect.ValueOf(response)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || !v.CanSet() {
+		return nil
+	}
+
+	if err := structs.FillHeader(v.Addr().Interface(), resp.Header); err != nil {
+		return newResponseError(resp, body, attempts, err.Error())
+	}
+	return nil
 }
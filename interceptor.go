@@ -0,0 +1,33 @@
+package builder
+
+import "net/http"
+
+// RequestInterceptor can inspect or mutate a request after it has been prepared,
+// right before it is sent. It runs again on every retry attempt.
+// Returning an error aborts the call.
+type RequestInterceptor func(request *http.Request) error
+
+// ResponseInterceptor sees the response and its raw body before the body is decoded.
+// The body is nil when a successful response is streamed to the caller.
+// Returning an error aborts the call.
+type ResponseInterceptor func(response *http.Response, body []byte) error
+
+// interceptRequest runs the request interceptors in order.
+func interceptRequest(request *http.Request, interceptors []RequestInterceptor) error {
+	for _, interceptor := range interceptors {
+		if err := interceptor(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interceptResponse runs the response interceptors in order.
+func interceptResponse(response *http.Response, body []byte, interceptors []ResponseInterceptor) error {
+	for _, interceptor := range interceptors {
+		if err := interceptor(response, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
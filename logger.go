@@ -0,0 +1,222 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogLevel is the severity of a log entry.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// LogField is a structured field of a log entry.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the structured log entries of the client.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, fields ...LogField)
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(ctx context.Context, level LogLevel, msg string, fields ...LogField)
+
+// Log calls f.
+func (f LoggerFunc) Log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+	f(ctx, level, msg, fields...)
+}
+
+// FieldsMap returns the fields as a map, as expected by many logging libraries.
+func FieldsMap(fields []LogField) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		m[field.Key] = field.Value
+	}
+	return m
+}
+
+// NewStdLogger returns a Logger writing to a standard library logger, log.Default() when l is nil.
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return LoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+		var line strings.Builder
+		line.WriteString(strings.ToUpper(level.String()) + " " + msg)
+		for _, field := range fields {
+			if s, ok := field.Value.(string); ok && strings.Contains(s, "\n") {
+				fmt.Fprintf(&line, "\n%s\n", s)
+				continue
+			}
+			fmt.Fprintf(&line, " %s=%v", field.Key, field.Value)
+		}
+		l.Print(line.String())
+	})
+}
+
+// ZapSugaredLogger is the subset of *zap.SugaredLogger used by NewZapLogger.
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// NewZapLogger returns a Logger writing to a zap logger, given as zapLogger.Sugar().
+func NewZapLogger(l ZapSugaredLogger) Logger {
+	return LoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+		keysAndValues := make([]interface{}, 0, 2*len(fields))
+		for _, field := range fields {
+			keysAndValues = append(keysAndValues, field.Key, field.Value)
+		}
+		switch level {
+		case LogLevelDebug:
+			l.Debugw(msg, keysAndValues...)
+		case LogLevelInfo:
+			l.Infow(msg, keysAndValues...)
+		case LogLevelWarn:
+			l.Warnw(msg, keysAndValues...)
+		default:
+			l.Errorw(msg, keysAndValues...)
+		}
+	})
+}
+
+// LogrusEntry is the subset of *logrus.Entry used by NewLogrusLogger.
+type LogrusEntry interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+}
+
+// NewLogrusLogger returns a Logger writing to logrus. withFields is usually
+//
+//   func(fields map[string]interface{}) LogrusEntry { return logger.WithFields(fields) }
+func NewLogrusLogger(withFields func(fields map[string]interface{}) LogrusEntry) Logger {
+	return LoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+		entry := withFields(FieldsMap(fields))
+		switch level {
+		case LogLevelDebug:
+			entry.Debug(msg)
+		case LogLevelInfo:
+			entry.Info(msg)
+		case LogLevelWarn:
+			entry.Warn(msg)
+		default:
+			entry.Error(msg)
+		}
+	})
+}
+
+// logger returns the logger of the configuration, falling back to the standard logger in debug mode.
+func (c *APIClient) logger() Logger {
+	if c.cfg.Logger != nil {
+		return c.cfg.Logger
+	}
+	if c.cfg.Debug {
+		return NewStdLogger(nil)
+	}
+	return nil
+}
+
+// log sends an entry to the logger when its level is enabled.
+func (c *APIClient) log(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+	logger := c.logger()
+	if logger == nil || level < c.cfg.LogLevel {
+		return
+	}
+	logger.Log(ctx, level, msg, fields...)
+}
+
+// logExchange logs the outcome of an attempt.
+func (c *APIClient) logExchange(request *http.Request, resp *http.Response, err error, attempt int, latency time.Duration) {
+	fields := []LogField{
+		{Key: "method", Value: request.Method},
+		{Key: "url", Value: request.URL.String()},
+		{Key: "attempt", Value: attempt},
+		{Key: "latency", Value: latency},
+		{Key: "request_bytes", Value: request.ContentLength},
+	}
+	if err != nil {
+		c.log(request.Context(), LogLevelError, "http request failed", append(fields, LogField{Key: "error", Value: err.Error()})...)
+		return
+	}
+
+	level := LogLevelInfo
+	if resp.StatusCode >= 500 {
+		level = LogLevelError
+	} else if resp.StatusCode >= 400 {
+		level = LogLevelWarn
+	}
+	fields = append(fields,
+		LogField{Key: "status", Value: resp.StatusCode},
+		LogField{Key: "response_bytes", Value: resp.ContentLength},
+	)
+	c.log(request.Context(), level, "http request", fields...)
+}
+
+// logDump prepares the dump of a request or a response for the logs:
+// secret body fields are masked and a long body is truncated. rest is the number of bytes
+// of the body left out of the dump, -1 when it is unknown.
+func (c *APIClient) logDump(dump []byte, rest int64) string {
+	head, body := dump, []byte(nil)
+	if end := bytes.Index(dump, []byte("\r\n\r\n")); end >= 0 {
+		head, body = dump[:end+4], dump[end+4:]
+	}
+
+	body = redactBodyFields(body, c.cfg.RedactBodyFields)
+	if limit := c.cfg.MaxLogBodySize; limit > 0 && len(body) > limit {
+		if rest >= 0 {
+			rest += int64(len(body) - limit)
+		}
+		body = body[:limit:limit]
+	}
+	switch {
+	case rest > 0:
+		body = append(body, fmt.Sprintf("... (%d bytes truncated)", rest)...)
+	case rest < 0:
+		body = append(body, "... (truncated)"...)
+	}
+	return string(head) + string(body)
+}
+
+// redactBodyFields masks the values of the given fields in a JSON or a form encoded body.
+func redactBodyFields(body []byte, fields []string) []byte {
+	for _, field := range fields {
+		name := regexp.QuoteMeta(field)
+		jsonField := regexp.MustCompile(`(?i)("` + name + `"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]\s]+)`)
+		body = jsonField.ReplaceAll(body, []byte(`${1}"`+redactedValue+`"`))
+		formField := regexp.MustCompile(`(?i)((?:^|&)` + name + `=)[^&\s]*`)
+		body = formField.ReplaceAll(body, []byte(`${1}`+redactedValue))
+	}
+	return body
+}
@@ -0,0 +1,32 @@
+package builder
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger writing to a log/slog logger, slog.Default() when l is nil.
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return LoggerFunc(func(ctx context.Context, level LogLevel, msg string, fields ...LogField) {
+		attrs := make([]slog.Attr, 0, len(fields))
+		for _, field := range fields {
+			attrs = append(attrs, slog.Any(field.Key, field.Value))
+		}
+		l.LogAttrs(ctx, slogLevel(level), msg, attrs...)
+	})
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelInfo:
+		return slog.LevelInfo
+	case LogLevelWarn:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
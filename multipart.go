@@ -0,0 +1,126 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+)
+
+// PartOption customizes a part of a multipart request.
+type PartOption func(*formPart)
+
+// PartContentType sets the Content-Type of a part.
+func PartContentType(contentType string) PartOption {
+	return func(p *formPart) {
+		p.contentType = contentType
+	}
+}
+
+// PartHeader adds a header to a part.
+func PartHeader(key string, value string) PartOption {
+	return func(p *formPart) {
+		p.header.Add(key, value)
+	}
+}
+
+// formPart is a file or a JSON value sent as a part of a multipart request.
+type formPart struct {
+	field       string
+	filename    string
+	contentType string
+	header      textproto.MIMEHeader
+	reader      io.Reader
+	offset      int64
+	value       interface{}
+}
+
+func newFormPart(field string, filename string, opts []PartOption) formPart {
+	part := formPart{
+		field:    field,
+		filename: filename,
+		header:   make(textproto.MIMEHeader),
+		offset:   -1,
+	}
+	for _, opt := range opts {
+		opt(&part)
+	}
+	return part
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// write writes the part into a multipart writer.
+func (p *formPart) write(w *multipart.Writer) error {
+	header := make(textproto.MIMEHeader)
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(p.field))
+	if p.filename != "" {
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(p.filename))
+	}
+	header.Set("Content-Disposition", disposition)
+	header.Set("Content-Type", p.contentType)
+	for key, values := range p.header {
+		header[key] = values
+	}
+
+	writer, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if p.reader != nil {
+		_, err = io.Copy(writer, p.reader)
+		return err
+	}
+	return json.NewEncoder(writer).Encode(p.value)
+}
+
+// rewindable reports whether the part can be written more than once.
+func (p *formPart) rewindable() bool {
+	return p.reader == nil || p.offset >= 0
+}
+
+// rewind moves the reader of the part back to where it started.
+func (p *formPart) rewind() error {
+	if p.reader == nil || p.offset < 0 {
+		return nil
+	}
+	_, err := p.reader.(io.Seeker).Seek(p.offset, io.SeekStart)
+	return err
+}
+
+// AddFile adds a file part read from r to a multipart request. It can be called
+// once per file. The part Content-Type defaults to application/octet-stream.
+func (b *builder) AddFile(field string, filename string, r io.Reader, opts ...PartOption) *builder {
+	part := newFormPart(field, filename, append([]PartOption{PartContentType("application/octet-stream")}, opts...))
+	part.reader = r
+	if seeker, ok := r.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			part.offset = offset
+		}
+	}
+	b.parts = append(b.parts, part)
+	return b
+}
+
+// AddJSONPart adds a part holding value encoded as JSON to a multipart request.
+func (b *builder) AddJSONPart(field string, value interface{}, opts ...PartOption) *builder {
+	part := newFormPart(field, "", append([]PartOption{PartContentType("application/json")}, opts...))
+	part.value = value
+	b.parts = append(b.parts, part)
+	return b
+}
+
+// multipartParts returns the parts of the request, including the file set with SetFileBytes.
+func (b *builder) multipartParts() []formPart {
+	if len(b.localVarFileBytes) == 0 || b.localVarFileName == "" {
+		return b.parts
+	}
+	part := newFormPart(b.localVarFormFileName, filepath.Base(b.localVarFileName), []PartOption{PartContentType("application/octet-stream")})
+	part.reader = bytes.NewReader(b.localVarFileBytes)
+	part.offset = 0
+	return append(b.parts[:len(b.parts):len(b.parts)], part)
+}
@@ -0,0 +1,314 @@
+package builder
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phuc1998/http-builder/structs"
+)
+
+// unwrapParam returns the value of a tagged field along with the options of its tag.
+// Values of untagged fields have no options.
+func unwrapParam(value interface{}) (interface{}, structs.TagOptions) {
+	if param, ok := value.(structs.Param); ok {
+		return param.Value, param.Options
+	}
+	return value, nil
+}
+
+// collectionFormat returns the collection format set by the tag options. Both the OpenAPI 2
+// formats and the OpenAPI 3 styles are accepted:
+//
+//	explode, multi        -> multi, one key per element
+//	csv, simple           -> csv
+//	ssv, spaceDelimited   -> ssv
+//	tsv                   -> tsv
+//	pipes, pipeDelimited  -> pipes
+//
+// Structs and maps are encoded in the deepObject, dot or json style.
+func collectionFormat(opts structs.TagOptions) string {
+	switch {
+	case opts.Has("deepObject"):
+		return "deepObject"
+	case opts.Has("dot"):
+		return "dot"
+	case opts.Has("json"):
+		return "json"
+	case opts.Has("explode") || opts.Has("multi"):
+		return "multi"
+	case opts.Has("csv") || opts.Has("simple"):
+		return "csv"
+	case opts.Has("ssv") || opts.Has("spaceDelimited"):
+		return "ssv"
+	case opts.Has("tsv"):
+		return "tsv"
+	case opts.Has("pipes") || opts.Has("pipeDelimited"):
+		return "pipes"
+	}
+	return ""
+}
+
+// isCollection returns true if v is a slice or an array, other than []byte.
+func isCollection(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// addValue adds a query or form value. The elements of a slice are joined in the collection
+// format, or added under repeated keys in the multi format, which is the default.
+// A struct or a map is encoded in the deepObject, dot or json style, or by default
+// with one key per field. A nil value is skipped.
+func addValue(values url.Values, key string, value interface{}, collectionFormat string, opts structs.TagOptions) error {
+	if collectionFormat == "json" {
+		s, err := parameterToJson(value)
+		if err != nil {
+			return err
+		}
+		values.Add(key, s)
+		return nil
+	}
+	if isObject(value) {
+		object, err := objectValues(value)
+		if err != nil {
+			return err
+		}
+		switch collectionFormat {
+		case "deepObject", "dot":
+			addObject(values, key, object, collectionFormat)
+		default:
+			addObject(values, "", object, "dot")
+		}
+		return nil
+	}
+	if collectionFormat == "" || collectionFormat == "multi" {
+		if v := reflect.ValueOf(value); isCollection(v) {
+			for i := 0; i < v.Len(); i++ {
+				s, ok, err := formatValue(v.Index(i).Interface(), opts)
+				if err != nil {
+					return err
+				}
+				if ok {
+					values.Add(key, s)
+				}
+			}
+			return nil
+		}
+	}
+	s, ok, err := formatParameter(value, collectionFormat, opts)
+	if err != nil {
+		return err
+	}
+	if ok {
+		values.Add(key, s)
+	}
+	return nil
+}
+
+// formatParam converts the value of a tagged field to a string, following the options of its tag.
+// The elements of a slice are comma separated unless another format is set. It returns false
+// for a nil value.
+func formatParam(value interface{}) (string, bool, error) {
+	value, opts := unwrapParam(value)
+	return formatParameter(value, collectionFormat(opts), opts)
+}
+
+// formatParameter converts a value to a string, joining the elements of a slice with the delimiter
+// of the collection format. It returns false for a nil value.
+func formatParameter(obj interface{}, collectionFormat string, opts structs.TagOptions) (string, bool, error) {
+	if b, ok := obj.([]byte); ok {
+		return string(b), true, nil
+	}
+	v := reflect.ValueOf(obj)
+	if !isCollection(v) {
+		return formatValue(obj, opts)
+	}
+
+	var delimiter string
+	switch collectionFormat {
+	case "pipes":
+		delimiter = "|"
+	case "ssv":
+		delimiter = " "
+	case "tsv":
+		delimiter = "\t"
+	default:
+		delimiter = ","
+	}
+
+	values := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		s, ok, err := formatValue(v.Index(i).Interface(), opts)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			values = append(values, s)
+		}
+	}
+	return strings.Join(values, delimiter), true, nil
+}
+
+// ParamMarshaler is implemented by types that encode themselves as a header, query, path or form value.
+type ParamMarshaler interface {
+	MarshalParam() (string, error)
+}
+
+// formatValue converts a single value to a string. It uses, in order, ParamMarshaler, the time
+// options for a time.Time, encoding.TextMarshaler and fmt.Stringer, and dereferences pointers.
+// It returns false for a nil value.
+func formatValue(value interface{}, opts structs.TagOptions) (string, bool, error) {
+	for {
+		if value == nil {
+			return "", false, nil
+		}
+		v := reflect.ValueOf(value)
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", false, nil
+		}
+
+		switch m := value.(type) {
+		case ParamMarshaler:
+			s, err := m.MarshalParam()
+			return s, err == nil, err
+		case time.Time:
+			return formatTime(m, opts), true, nil
+		case *time.Time:
+			return formatTime(*m, opts), true, nil
+		case encoding.TextMarshaler:
+			b, err := m.MarshalText()
+			return string(b), err == nil, err
+		case fmt.Stringer:
+			return m.String(), true, nil
+		}
+
+		if v.Kind() != reflect.Ptr {
+			return fmt.Sprintf("%v", value), true, nil
+		}
+		value = v.Elem().Interface()
+	}
+}
+
+// formatTime formats a time with the layout=<layout>, unix or unixmilli tag option, in RFC3339 by default.
+func formatTime(t time.Time, opts structs.TagOptions) string {
+	if layout, ok := opts.Value("layout"); ok && layout != "" {
+		return t.Format(layout)
+	}
+	if opts.Has("unix") {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if opts.Has("unixmilli") {
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// isObject returns true if value is a struct or a map, other than a time.Time or a
+// value with its own text encoding.
+func isObject(value interface{}) bool {
+	switch value.(type) {
+	case time.Time, *time.Time, ParamMarshaler, encoding.TextMarshaler, fmt.Stringer:
+		return false
+	}
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Struct || v.Kind() == reflect.Map
+}
+
+// objectValues returns the fields of a struct or a map as they are encoded in JSON.
+func objectValues(value interface{}) (interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var object interface{}
+	err = decoder.Decode(&object)
+	return object, err
+}
+
+// addObject adds the fields of a decoded JSON value under keys such as filter[name] in the
+// deepObject style or filter.name in the dot style. Slices of scalars repeat their key,
+// the elements of other slices are indexed.
+func addObject(values url.Values, key string, object interface{}, style string) {
+	switch o := object.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(o))
+		for name := range o {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			addObject(values, objectKey(key, name, style), o[name], style)
+		}
+	case []interface{}:
+		for i, element := range o {
+			switch element.(type) {
+			case map[string]interface{}, []interface{}:
+				addObject(values, objectKey(key, strconv.Itoa(i), style), element, style)
+			default:
+				addObject(values, key, element, style)
+			}
+		}
+	case nil:
+	default:
+		values.Add(key, fmt.Sprint(o))
+	}
+}
+
+// objectKey returns the key of a field of an object.
+func objectKey(key string, name string, style string) string {
+	if key == "" {
+		return name
+	}
+	if style == "deepObject" {
+		return key + "[" + name + "]"
+	}
+	return key + "." + name
+}
+
+// addError records an error found while building the request, returned by Call.
+func (b *builder) addError(err error) {
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+}
+
+// addParam adds the value of a query or form field, following the options of its tag.
+func (b *builder) addParam(values url.Values, key string, value interface{}) {
+	value, opts := unwrapParam(value)
+	b.addError(addValue(values, key, value, collectionFormat(opts), opts))
+}
+
+// setHeaderParam sets the value of a header field, following the options of its tag.
+func (b *builder) setHeaderParam(key string, value interface{}) {
+	s, ok, err := formatParam(value)
+	b.addError(err)
+	if ok {
+		b.localVarHeaderParams[key] = s
+	}
+}
+
+// setPathParam sets the value of the :key or {key} placeholder from a path field, following
+// the options of its tag. The value is inserted without escaping with the raw option.
+func (b *builder) setPathParam(key string, value interface{}) {
+	value, opts := unwrapParam(value)
+	s, ok, err := formatParameter(value, collectionFormat(opts), opts)
+	b.addError(err)
+	if ok {
+		b.setPath(key, s, opts.Has("raw"))
+	}
+}
@@ -0,0 +1,49 @@
+package builder
+
+import "encoding/json"
+
+const (
+	// JSONPatchContentType is the media type of a JSON Patch document (RFC 6902).
+	JSONPatchContentType = "application/json-patch+json"
+
+	// MergePatchContentType is the media type of a JSON Merge Patch document (RFC 7396).
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+// JSONPatchOperation is a single operation of a JSON Patch document.
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON always writes the value of the add, replace and test operations, even when it is empty.
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	type operation JSONPatchOperation
+	switch o.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			operation
+			Value interface{} `json:"value"`
+		}{operation(o), o.Value})
+	}
+	return json.Marshal(operation(o))
+}
+
+// SetJSONPatch sets a JSON Patch document as the body of the request.
+func (b *builder) SetJSONPatch(operations ...JSONPatchOperation) *builder {
+	if operations == nil {
+		operations = []JSONPatchOperation{}
+	}
+	b.localVarPostBody = operations
+	b.localVarHTTPContentTypes = []string{JSONPatchContentType}
+	return b
+}
+
+// SetMergePatch sets a JSON Merge Patch document as the body of the request.
+func (b *builder) SetMergePatch(patch interface{}) *builder {
+	b.localVarPostBody = patch
+	b.localVarHTTPContentTypes = []string{MergePatchContentType}
+	return b
+}
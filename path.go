@@ -0,0 +1,176 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrUnresolvedPath is returned by Call when a placeholder of the path has no value.
+var ErrUnresolvedPath = errors.New("unresolved path parameters")
+
+// pathParam is the value of a path placeholder.
+type pathParam struct {
+	value string
+	raw   bool
+}
+
+// setPath sets the value of the placeholder key. A raw value is inserted without escaping.
+func (b *builder) setPath(key, value string, raw bool) {
+	if b.pathParams == nil {
+		b.pathParams = make(map[string]pathParam)
+	}
+	b.pathParams[key] = pathParam{value: value, raw: raw}
+}
+
+// expandPath replaces the placeholders of a path template by the values of params.
+//
+// A placeholder is either :name at the start of a segment, or {name} anywhere in the path.
+// Values are percent-escaped as a single segment, so a slash is sent as %2F. A wildcard
+// placeholder, *name or {name*}, keeps the slashes of its value and escapes each segment.
+// Raw values are inserted as is. Nothing after the query or the fragment is replaced.
+func expandPath(template string, params map[string]pathParam) (string, error) {
+	var (
+		path    strings.Builder
+		missing []string
+	)
+
+	expand := func(token, name string, wildcard bool) {
+		param, ok := params[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+			path.WriteString(token)
+		case param.raw:
+			path.WriteString(param.value)
+		case wildcard:
+			segments := strings.Split(param.value, "/")
+			for i, segment := range segments {
+				segments[i] = url.PathEscape(segment)
+			}
+			path.WriteString(strings.Join(segments, "/"))
+		default:
+			path.WriteString(url.PathEscape(param.value))
+		}
+	}
+
+	for i := 0; i < len(template); {
+		c := template[i]
+		switch {
+		case c == '?' || c == '#':
+			path.WriteString(template[i:])
+			i = len(template)
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			name := ""
+			if end > 0 {
+				name = template[i+1 : i+end]
+			}
+			wildcard := strings.HasSuffix(name, "*")
+			name = strings.TrimSuffix(name, "*")
+			if name == "" || strings.ContainsAny(name, "/{") {
+				path.WriteByte(c)
+				i++
+				continue
+			}
+			expand(template[i:i+end+1], name, wildcard)
+			i += end + 1
+		case (c == ':' || c == '*') && (i == 0 || template[i-1] == '/'):
+			j := i + 1
+			for j < len(template) && isPathNameChar(template[j]) {
+				j++
+			}
+			if j == i+1 {
+				path.WriteByte(c)
+				i++
+				continue
+			}
+			expand(template[i:j], template[i+1:j], c == '*')
+			i = j
+		default:
+			path.WriteByte(c)
+			i++
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrUnresolvedPath, strings.Join(missing, ", "))
+	}
+	return path.String(), nil
+}
+
+// isPathNameChar returns true if c can be part of the name of a :name placeholder.
+func isPathNameChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// requestURL returns the URL of the request, the expanded path resolved against the base path
+// or the chosen server. When the load balancer picks the server of each attempt, it also returns
+// what send needs to move the request to that server.
+func (b *builder) requestURL(ctx context.Context) (string, *balancedTarget, error) {
+	path, err := expandPath(b.uri, b.pathParams)
+	if err != nil {
+		return "", nil, err
+	}
+	basePath, servers, err := b.basePath(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	url, err := resolveURL(basePath, path)
+	if err != nil || servers == nil || isAbsoluteURL(path) {
+		return url, nil, err
+	}
+	return url, &balancedTarget{servers: servers, path: path, query: b.localVarQueryParams}, nil
+}
+
+// resolveURL resolves the uri of a builder against the base path, following RFC 3986.
+//
+// The base path is treated as a directory and the uri as relative to it, whether it starts
+// with a slash or not, so "/v1" and "/booking" give "/v1/booking". Dot segments are resolved
+// and the query of the base path is kept. An absolute uri, such as a pagination link, is
+// returned as is.
+func resolveURL(basePath, uri string) (string, error) {
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if ref.IsAbs() || basePath == "" {
+		return uri, nil
+	}
+	if uri == "" {
+		return basePath, nil
+	}
+
+	base, err := url.Parse(basePath)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		if base.RawPath != "" {
+			base.RawPath += "/"
+		}
+	}
+
+	// "./" keeps a first segment holding a colon from being read as a scheme
+	ref, err = url.Parse("./" + strings.TrimLeft(uri, "/"))
+	if err != nil {
+		return "", err
+	}
+	resolved := base.ResolveReference(ref)
+	switch {
+	case base.RawQuery != "" && ref.RawQuery != "":
+		resolved.RawQuery = base.RawQuery + "&" + ref.RawQuery
+	case base.RawQuery != "":
+		resolved.RawQuery = base.RawQuery
+	}
+	return resolved.String(), nil
+}
+
+// isAbsoluteURL returns true if the uri has a scheme.
+func isAbsoluteURL(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.IsAbs()
+}
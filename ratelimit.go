@@ -0,0 +1,238 @@
+package builder
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket letting Requests calls through every Per, with bursts of up to
+// Burst calls. A zero RateLimit does not limit anything.
+type RateLimit struct {
+	// Requests is the number of calls per period.
+	Requests int
+	// Per is the period, one second by default.
+	Per time.Duration
+	// Burst is the number of calls let through at once, Requests by default.
+	Burst int
+}
+
+// RateLimiter holds the calls of the client until they fit the rate limits and the concurrency
+// cap. A call waits for a token of the global bucket, then of the bucket of its host and of the
+// bucket of its route, then for a free slot, or until its context is done.
+type RateLimiter struct {
+	// Global limits every call of the client.
+	Global RateLimit
+	// PerHost limits the calls to each host.
+	PerHost RateLimit
+	// Routes limits the calls of the builders by uri template, such as "/booking/:id".
+	Routes map[string]RateLimit
+	// MaxInFlight caps the calls in progress, until their response body is closed. 0 means no cap.
+	MaxInFlight int
+	// Adaptive holds the calls to a host when a response says its quota is used up, through
+	// Retry-After, or X-RateLimit-Remaining: 0 along with X-RateLimit-Reset.
+	Adaptive bool
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	holds   map[string]time.Time
+	slots   chan struct{}
+}
+
+// bucket is the state of a token bucket.
+type bucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns an adaptive rate limiter with the given global limit.
+func NewRateLimiter(global RateLimit) *RateLimiter {
+	return &RateLimiter{Global: global, Adaptive: true}
+}
+
+// SetRouteLimit limits the calls of the builders with the given uri template.
+func (rl *RateLimiter) SetRouteLimit(route string, limit RateLimit) *RateLimiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.Routes == nil {
+		rl.Routes = make(map[string]RateLimit)
+	}
+	rl.Routes[route] = limit
+	return rl
+}
+
+// wait blocks until the call to host of the route can proceed or ctx is done. The returned
+// function frees the slot of the call.
+func (rl *RateLimiter) wait(ctx context.Context, host, route string) (func(), error) {
+	rl.mu.Lock()
+	routeLimit := rl.Routes[route]
+	rl.mu.Unlock()
+
+	if err := rl.take(ctx, "", rl.Global); err != nil {
+		return nil, err
+	}
+	if err := rl.hold(ctx, host); err != nil {
+		return nil, err
+	}
+	if err := rl.take(ctx, "host "+host, rl.PerHost); err != nil {
+		return nil, err
+	}
+	if err := rl.take(ctx, "route "+route, routeLimit); err != nil {
+		return nil, err
+	}
+
+	if rl.MaxInFlight <= 0 {
+		return func() {}, nil
+	}
+	rl.mu.Lock()
+	if rl.slots == nil {
+		rl.slots = make(chan struct{}, rl.MaxInFlight)
+	}
+	slots := rl.slots
+	rl.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-slots }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// take waits for a token of the bucket key.
+func (rl *RateLimiter) take(ctx context.Context, key string, limit RateLimit) error {
+	if limit.Requests <= 0 {
+		return nil
+	}
+
+	rl.mu.Lock()
+	b := rl.bucket(key, limit)
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	rl.mu.Unlock()
+
+	if err := sleep(ctx, wait); err != nil {
+		// give the token back
+		rl.mu.Lock()
+		b.tokens++
+		rl.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// bucket returns the bucket key, created full.
+func (rl *RateLimiter) bucket(key string, limit RateLimit) *bucket {
+	if rl.buckets == nil {
+		rl.buckets = make(map[string]*bucket)
+	}
+	b, ok := rl.buckets[key]
+	if !ok {
+		per := limit.Per
+		if per <= 0 {
+			per = time.Second
+		}
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.Requests
+		}
+		b = &bucket{
+			rate:   float64(limit.Requests) / per.Seconds(),
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+		}
+		rl.buckets[key] = b
+	}
+	return b
+}
+
+// hold waits until the quota of the host is reset.
+func (rl *RateLimiter) hold(ctx context.Context, host string) error {
+	rl.mu.Lock()
+	until := rl.holds[host]
+	rl.mu.Unlock()
+	return sleep(ctx, time.Until(until))
+}
+
+// observe holds the calls to the host when the response says its quota is used up.
+func (rl *RateLimiter) observe(host string, resp *http.Response) {
+	if !rl.Adaptive || resp == nil {
+		return
+	}
+
+	var until time.Time
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := retryAfter(resp); ok {
+			until = time.Now().Add(d)
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, ok := rateLimitReset(resp.Header.Get("X-RateLimit-Reset")); ok && reset.After(until) {
+			until = reset
+		}
+	}
+	if until.IsZero() {
+		return
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.holds == nil {
+		rl.holds = make(map[string]time.Time)
+	}
+	if until.After(rl.holds[host]) {
+		rl.holds[host] = until
+	}
+}
+
+// rateLimitReset parses X-RateLimit-Reset, given either as a Unix time or as a number of
+// seconds until the reset.
+func rateLimitReset(value string) (time.Time, bool) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false
+	}
+	// a number of seconds larger than a year is a Unix time
+	if seconds > 365*24*60*60 {
+		return time.Unix(int64(seconds), 0), true
+	}
+	return time.Now().Add(time.Duration(seconds * float64(time.Second))), true
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// releaseBody frees the slot of a call when its response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,95 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	limiter := NewRateLimiter(RateLimit{Requests: 20, Per: time.Second, Burst: 1})
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRateLimiter(limiter))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 calls at 20/s took %s", elapsed)
+	}
+
+	// A call waiting for a token gives up with its context
+	limiter.SetRouteLimit("/slow", RateLimit{Requests: 1, Per: time.Hour})
+	apiClient.Builder("/slow").Call(context.Background(), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := apiClient.Builder("/slow").Call(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a deadline error, got %v", err)
+	}
+}
+
+func TestRateLimiterMaxInFlight(t *testing.T) {
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	limiter := &RateLimiter{MaxInFlight: 2}
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRateLimiter(limiter))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight > 2 {
+		t.Errorf("%d calls in flight", maxInFlight)
+	}
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	var calls []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1")
+		}
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRateLimiter(NewRateLimiter(RateLimit{})))
+	for i := 0; i < 2; i++ {
+		if _, err := apiClient.Builder("/booking").Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wait := calls[1].Sub(calls[0]); wait < 900*time.Millisecond {
+		t.Errorf("the second call was not held until the reset, waited %s", wait)
+	}
+}
@@ -0,0 +1,189 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy describes how a failed call is retried.
+// A nil policy or a policy with MaxAttempts <= 1 disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every attempt (default 2).
+	Multiplier float64
+	// Jitter randomizes each backoff by up to this fraction, between 0 and 1.
+	Jitter float64
+	// RetryableMethods lists the request methods worth retrying. When empty only the idempotent
+	// methods are: GET, HEAD, OPTIONS, PUT and DELETE. Add POST or PATCH only when the server
+	// can tell the attempts of a call apart, for instance with an idempotency key.
+	RetryableMethods []string
+	// RetryableStatusCodes lists the response status codes worth retrying.
+	RetryableStatusCodes []int
+	// RetryableError reports whether a transport error is worth retrying.
+	// When nil every error is retried except context cancellation.
+	RetryableError func(err error) bool
+	// RespectRetryAfter waits for the duration given by a Retry-After header
+	// instead of the computed backoff, capped by MaxBackoff when it is set.
+	RespectRetryAfter bool
+}
+
+// idempotentMethods are the methods retried when a policy does not list its own.
+var idempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// DefaultRetryPolicy returns a policy with three attempts and exponential backoff
+// that retries transport errors, 408, 429 and 5xx gateway errors of idempotent methods.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:      3,
+		InitialBackoff:   100 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		Multiplier:       2,
+		Jitter:           0.2,
+		RetryableMethods: append([]string(nil), idempotentMethods...),
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RespectRetryAfter: true,
+	}
+}
+
+// retryable reports whether the calls with the given method are worth retrying.
+func (p *RetryPolicy) retryable(method string) bool {
+	methods := p.RetryableMethods
+	if len(methods) == 0 {
+		methods = idempotentMethods
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry reports whether the outcome of an attempt of a request is worth retrying.
+func (p *RetryPolicy) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if !p.retryable(req.Method) {
+		return false
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		if p.RetryableError != nil {
+			return p.RetryableError(err)
+		}
+		return true
+	}
+	if resp == nil {
+		return false
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the attempt following the given one.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		wait -= wait * jitter * rand.Float64()
+	}
+	return time.Duration(wait)
+}
+
+// wait returns how long to sleep before retrying after resp.
+func (p *RetryPolicy) wait(attempt int, resp *http.Response) time.Duration {
+	if p.RespectRetryAfter {
+		if d, ok := retryAfter(resp); ok {
+			if p.MaxBackoff > 0 && d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+	return p.backoff(attempt)
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		d := time.Until(date)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// rewindRequest returns a copy of the request with a fresh body so it can be sent again.
+func rewindRequest(request *http.Request) (*http.Request, error) {
+	req := request.Clone(request.Context())
+	if request.Body == nil || request.Body == http.NoBody {
+		return req, nil
+	}
+	if request.GetBody == nil {
+		return nil, errors.New("request body cannot be replayed")
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = body
+	return req, nil
+}
+
+// drainBody discards what is left of a response body so the connection can be reused.
+func drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,148 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryReplaysBody(t *testing.T) {
+	var (
+		attempts int
+		bodies   []string
+		response = PostResponse{}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"statusCode":200,"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.RetryableMethods = append(policy.RetryableMethods, http.MethodPost)
+
+	cfg := NewConfiguration().AddBasePath(server.URL).AddRetryPolicy(policy)
+	apiClient := NewAPIClient(cfg)
+	_, err := apiClient.Builder("/booking").
+		Post().
+		SetBody(RequestBody{CompanyId: "1", Name: "phuc"}).
+		Call(context.Background(), &response)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+	for _, body := range bodies {
+		if body != bodies[0] || body == "" {
+			t.Fatalf("body was not replayed: %q", bodies)
+		}
+	}
+	if response.Message != "ok" {
+		t.Errorf("unexpected response %v", response)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var attempts int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Hour
+
+	cfg := NewConfiguration().AddBasePath(server.URL)
+	apiClient := NewAPIClient(cfg)
+	resp, err := apiClient.Builder("/booking").
+		SetRetryPolicy(policy).
+		Call(context.Background(), nil)
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if resp.StatusCode != http.StatusTooManyRequests || attempts != policy.MaxAttempts {
+		t.Errorf("unexpected status %d after %d attempts", resp.StatusCode, attempts)
+	}
+}
+
+func TestRetryIdempotentMethods(t *testing.T) {
+	var attempts int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRetryPolicy(policy))
+	for _, b := range []*builder{
+		apiClient.Builder("/booking").Post().SetBody(RequestBody{Name: "phuc"}),
+		apiClient.Builder("/booking").Patch().SetBody(RequestBody{Name: "phuc"}),
+		apiClient.Builder("/booking").Put().SetBody(RequestBody{Name: "phuc"}),
+		apiClient.Builder("/booking").Delete(),
+	} {
+		attempts = 0
+		if _, err := b.Call(context.Background(), nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		expected := policy.MaxAttempts
+		if b.localVarHTTPMethod == http.MethodPost || b.localVarHTTPMethod == http.MethodPatch {
+			expected = 1
+		}
+		if attempts != expected {
+			t.Errorf("%s: %d attempts, expected %d", b.localVarHTTPMethod, attempts, expected)
+		}
+	}
+}
+
+func TestRetryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"message":`))
+	}))
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRetryPolicy(policy))
+
+	// a response that cannot be decoded
+	var apiErr GenericOpenAPIError
+	_, err := apiClient.Builder("/booking").Call(context.Background(), &PostResponse{})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode() != http.StatusOK || apiErr.Attempts() != 1 {
+		t.Errorf("unexpected decode error %v", err)
+	}
+
+	// no response after the last attempt
+	server.Close()
+	_, err = apiClient.Builder("/booking").Call(context.Background(), nil)
+	var urlErr *url.Error
+	if !errors.As(err, &apiErr) || !errors.As(err, &urlErr) {
+		t.Fatalf("unexpected transport error %T %v", err, err)
+	}
+	if apiErr.StatusCode() != 0 || apiErr.Attempts() != policy.MaxAttempts ||
+		apiErr.Method() != http.MethodGet || apiErr.URL() != server.URL+"/booking" {
+		t.Errorf("unexpected error details %+v", apiErr)
+	}
+}
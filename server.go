@@ -0,0 +1,112 @@
+package builder
+
+import "context"
+
+// UseServer resolves the uri against the server of the configuration at the given index
+// instead of the base path
+func (b *builder) UseServer(index int) *builder {
+	b.serverIndex, b.serverName = index, ""
+	return b
+}
+
+// UseServerName resolves the uri against the server of the configuration with the given name
+// instead of the base path
+func (b *builder) UseServerName(name string) *builder {
+	b.serverIndex, b.serverName = -1, name
+	return b
+}
+
+// SetServerVariable sets a variable of the server URL, overriding the variables of the context
+func (b *builder) SetServerVariable(name string, value string) *builder {
+	if b.serverVariables == nil {
+		b.serverVariables = make(map[string]string)
+	}
+	b.serverVariables[name] = value
+	return b
+}
+
+// Operation names the operation of the request, which chooses its servers
+// in Configuration.OperationServers and in the operation context values
+func (b *builder) Operation(operation string) *builder {
+	b.operation = operation
+	return b
+}
+
+// basePath returns the URL the uri is resolved against.
+//
+// The servers of the operation, when there are some, replace the servers of the configuration.
+// A server is chosen by the ContextServerIndex or ContextOperationServerIndices value of the
+// context, or by UseServer or UseServerName which take precedence. Without any choice, the load
+// balancer of the configuration spreads the calls across the servers and their URLs are returned
+// too. Otherwise the first server of the operation, or the base path of the configuration, is used.
+// The variables of the server URLs come from ContextServerVariables, ContextOperationServerVariables
+// and SetServerVariable, the latter overriding the former.
+func (b *builder) basePath(ctx context.Context) (string, []string, error) {
+	var (
+		cfg              = b.a.client.cfg
+		servers          = cfg.Servers
+		operationServers = cfg.OperationServers[b.operation]
+		index            = -1
+	)
+
+	if b.operation != "" && len(operationServers) > 0 {
+		servers = operationServers
+	}
+	if i, ok := ctx.Value(ContextServerIndex).(int); ok {
+		index = i
+	}
+	if indices, ok := ctx.Value(ContextOperationServerIndices).(map[string]int); ok && b.operation != "" {
+		if i, ok := indices[b.operation]; ok {
+			index = i
+		}
+	}
+	if b.serverName != "" {
+		i, err := serverIndex(servers, b.serverName)
+		if err != nil {
+			return "", nil, err
+		}
+		index = i
+	} else if b.serverIndex >= 0 {
+		index = b.serverIndex
+	}
+
+	variables := b.variables(ctx)
+	if index < 0 && cfg.LoadBalancer != nil && len(servers) > 0 && !(len(servers) == 1 && isDefaultServer(servers[0])) {
+		urls := make([]string, len(servers))
+		for i := range servers {
+			url, err := serverUrl(servers, i, variables)
+			if err != nil {
+				return "", nil, err
+			}
+			urls[i] = url
+		}
+		return urls[0], urls, nil
+	}
+	if index < 0 && b.operation != "" && len(operationServers) > 0 {
+		index = 0
+	}
+	if index < 0 {
+		return cfg.BasePath, nil, nil
+	}
+	url, err := serverUrl(servers, index, variables)
+	return url, nil, err
+}
+
+// variables returns the variables of the server URLs.
+func (b *builder) variables(ctx context.Context) map[string]string {
+	variables := make(map[string]string)
+	if values, ok := ctx.Value(ContextServerVariables).(map[string]string); ok {
+		for name, value := range values {
+			variables[name] = value
+		}
+	}
+	if operations, ok := ctx.Value(ContextOperationServerVariables).(map[string]map[string]string); ok && b.operation != "" {
+		for name, value := range operations[b.operation] {
+			variables[name] = value
+		}
+	}
+	for name, value := range b.serverVariables {
+		variables[name] = value
+	}
+	return variables
+}
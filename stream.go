@@ -0,0 +1,104 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Stream sends the request and returns the open body of a successful response instead of reading it.
+// The caller must close the body. The body of an unsuccessful response is read and returned
+// in a GenericOpenAPIError as with Call.
+func (b *builder) Stream(ctx context.Context) (io.ReadCloser, *http.Response, error) {
+	localVarHTTPResponse, attempts, opts, err := b.open(ctx, true)
+	if err != nil || localVarHTTPResponse == nil {
+		return nil, localVarHTTPResponse, err
+	}
+
+	if localVarHTTPResponse.StatusCode >= 300 {
+		_, _, err = b.readResponse(localVarHTTPResponse, attempts, opts)
+		return nil, localVarHTTPResponse, err
+	}
+
+	if err = interceptResponse(localVarHTTPResponse, nil, opts.responseInterceptors); err != nil {
+		localVarHTTPResponse.Body.Close()
+		return nil, localVarHTTPResponse, err
+	}
+
+	return localVarHTTPResponse.Body, localVarHTTPResponse, nil
+}
+
+// Download streams the body of a successful response into w and returns the number of bytes written.
+func (b *builder) Download(ctx context.Context, w io.Writer) (int64, *http.Response, error) {
+	body, localVarHTTPResponse, err := b.Stream(ctx)
+	if err != nil {
+		return 0, localVarHTTPResponse, err
+	}
+	defer body.Close()
+
+	n, err := io.Copy(w, body)
+	return n, localVarHTTPResponse, err
+}
+
+// DownloadFile streams the body of a successful response into the file at path.
+// The file is written next to its destination first, and only renamed to path once complete.
+func (b *builder) DownloadFile(ctx context.Context, path string) (int64, *http.Response, error) {
+	body, localVarHTTPResponse, err := b.Stream(ctx)
+	if err != nil {
+		return 0, localVarHTTPResponse, err
+	}
+	defer body.Close()
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.part")
+	if err != nil {
+		return 0, localVarHTTPResponse, err
+	}
+	defer os.Remove(file.Name())
+
+	n, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, localVarHTTPResponse, err
+	}
+	return n, localVarHTTPResponse, os.Rename(file.Name(), path)
+}
+
+// StreamJSON sends the request and decodes a JSON array response one element at a time,
+// calling fn for each of them, so that the whole array never sits in memory.
+// Returning an error from fn stops the decoding and closes the response.
+func StreamJSON[T any](ctx context.Context, b *builder, fn func(T) error) (*http.Response, error) {
+	body, localVarHTTPResponse, err := b.Stream(ctx)
+	if err != nil {
+		return localVarHTTPResponse, err
+	}
+	defer body.Close()
+
+	decoder := json.NewDecoder(body)
+	token, err := decoder.Token()
+	if err != nil {
+		return localVarHTTPResponse, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return localVarHTTPResponse, fmt.Errorf("expected a JSON array, got %v", token)
+	}
+
+	for decoder.More() {
+		var element T
+		if err = decoder.Decode(&element); err != nil {
+			return localVarHTTPResponse, err
+		}
+		if err = fn(element); err != nil {
+			return localVarHTTPResponse, err
+		}
+	}
+
+	_, err = decoder.Token()
+	return localVarHTTPResponse, err
+}
@@ -0,0 +1,208 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"uuid":"1","name":"a"},{"uuid":"2","name":"b"},{"uuid":"3","name":"c"}]`))
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+
+	var names string
+	_, err := StreamJSON(context.Background(), apiClient.Builder("/export"), func(d Data) error {
+		names += d.Name
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names != "abc" {
+		t.Errorf("unexpected elements %q", names)
+	}
+
+	var buf bytes.Buffer
+	n, _, err := apiClient.Builder("/export").Download(context.Background(), &buf)
+	if err != nil || n != int64(buf.Len()) || buf.Len() == 0 {
+		t.Fatalf("unexpected download of %d bytes: %v", n, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "export.json")
+	if _, _, err = apiClient.Builder("/export").DownloadFile(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Equal(content, buf.Bytes()) {
+		t.Errorf("unexpected file content %q: %v", content, err)
+	}
+}
+
+func TestStreamRequestBody(t *testing.T) {
+	var (
+		attempts int
+		received []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("upload")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			content, _ := ioutil.ReadAll(file)
+			received = append(received, r.FormValue("name")+":"+string(content))
+		} else {
+			content, _ := ioutil.ReadAll(r.Body)
+			received = append(received, fmt.Sprintf("%d:%s", r.ContentLength, content))
+		}
+		if attempts%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.RetryableMethods = append(policy.RetryableMethods, http.MethodPost)
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRetryPolicy(policy))
+
+	_, err := apiClient.Builder("/upload").
+		Put().
+		StreamRequestBody().
+		SetBody(strings.NewReader("raw content")).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err = ioutil.WriteFile(path, []byte("file content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = apiClient.Builder("/upload").
+		Post().
+		StreamRequestBody().
+		UseMultipartFormData().
+		SetFormParam("name", "report").
+		SetFormParam("@upload", path).
+		Call(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[11:raw content 11:raw content report:file content report:file content]"
+	if fmt.Sprint(received) != expected {
+		t.Errorf("unexpected bodies %v", received)
+	}
+}
+
+func TestMultipartParts(t *testing.T) {
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			content, _ := ioutil.ReadAll(part)
+			received = append(received, fmt.Sprintf("%s|%s|%s|%s|%s", part.FormName(), part.FileName(),
+				part.Header.Get("Content-Type"), part.Header.Get("X-Checksum"), strings.TrimSpace(string(content))))
+		}
+	}))
+	defer server.Close()
+
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL))
+	for _, stream := range []bool{false, true} {
+		received = nil
+		b := apiClient.Builder("/upload").
+			Post().
+			AddJSONPart("metadata", RequestBody{CompanyId: "1", Name: "phuc"}).
+			AddFile("files", "a.txt", strings.NewReader("first"), PartContentType("text/plain")).
+			AddFile("files", "b.bin", bytes.NewReader([]byte("second")), PartHeader("X-Checksum", "abc"))
+		if stream {
+			b.StreamRequestBody()
+		}
+		if _, err := b.Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := `[metadata||application/json||{"companyId":"1","name":"phuc"} ` +
+			`files|a.txt|text/plain||first files|b.bin|application/octet-stream|abc|second]`
+		if fmt.Sprint(received) != expected {
+			t.Errorf("unexpected parts %v", received)
+		}
+	}
+}
+
+func TestStreamRequestBodyEarlyReply(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1<<20)
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		attempt := attempts
+		mu.Unlock()
+		// reply before the body is read
+		if attempt%3 != 0 {
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var received []byte
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("upload")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			received, _ = ioutil.ReadAll(file)
+		} else {
+			received, _ = ioutil.ReadAll(r.Body)
+		}
+		if !bytes.Equal(received, content) {
+			t.Errorf("attempt %d: corrupted body of %d bytes", attempt, len(received))
+		}
+	}))
+	defer server.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	apiClient := NewAPIClient(NewConfiguration().AddBasePath(server.URL).AddRetryPolicy(policy))
+
+	for _, b := range []*builder{
+		apiClient.Builder("/upload").Put().StreamRequestBody().AddFile("upload", "data.bin", bytes.NewReader(content)),
+		apiClient.Builder("/upload").Put().StreamRequestBody().SetBody(bytes.NewReader(content)),
+	} {
+		if _, err := b.Call(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if attempts != 6 {
+		t.Errorf("%d attempts, expected 6", attempts)
+	}
+}
@@ -0,0 +1,198 @@
+package structs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// FillHeader sets the fields tagged with the "header" option from the values
+// of the given header, the reverse of the "_header_" key of Map. Fields whose
+// header is missing are left untouched. Example:
+//
+//   // Set from the "X-RateLimit-Remaining" response header.
+//   Remaining int `http:"X-RateLimit-Remaining,header"`
+//
+// Strings, booleans, numbers, slices and pointers of them are converted with
+// strconv, and types implementing encoding.TextUnmarshaler decode themselves.
+// A time.Time is parsed as an HTTP date or RFC3339, unless the "layout=<layout>",
+// "unix" or "unixmilli" option is set. A time.Duration is parsed as a number of
+// seconds or a Go duration. Embedded structs are filled too.
+//
+// It returns an error if s was not given as a pointer to a struct.
+func (s *Struct) FillHeader(header http.Header) error {
+	if !s.value.CanSet() {
+		return errors.New("structs: FillHeader needs a pointer to a struct")
+	}
+	return fillHeader(s.value, s.TagName, header)
+}
+
+func fillHeader(v reflect.Value, tagName string, header http.Header) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// we can't set the value of unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+
+		name, tagOpts := parseTag(tag)
+		if !tagOpts.Has("header") {
+			if tag == "" && field.Anonymous {
+				embedded := v.Field(i)
+				if embedded.Kind() == reflect.Ptr {
+					if embedded.IsNil() {
+						continue
+					}
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					if err := fillHeader(embedded, tagName, header); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		values := header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setHeaderValue(v.Field(i), values, tagOpts); err != nil {
+			return fmt.Errorf("structs: header %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// setHeaderValue converts the values of a header to the type of v.
+func setHeaderValue(v reflect.Value, values []string, tagOpts TagOptions) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setHeaderValue(elem.Elem(), values, tagOpts); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := parseTime(values[0], tagOpts)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := parseDuration(values[0])
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(values[0])
+	case reflect.Bool:
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(values[0], 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(values[0], 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(values[0], v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setHeaderValue(slice.Index(i), []string{value}, tagOpts); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// parseTime parses a time with the layout=<layout>, unix or unixmilli tag
+// option, or as an HTTP date or RFC3339 by default.
+func parseTime(value string, tagOpts TagOptions) (time.Time, error) {
+	if layout, ok := tagOpts.Value("layout"); ok && layout != "" {
+		return time.Parse(layout, value)
+	}
+	if tagOpts.Has("unix") || tagOpts.Has("unixmilli") {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if tagOpts.Has("unixmilli") {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// parseDuration parses a number of seconds, as in Retry-After, or a Go duration.
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// FillHeader sets the fields of s tagged with the "header" option from the
+// values of the given header. For more info refer to Struct types FillHeader()
+// method. It panics if s's kind is not struct.
+func FillHeader(s interface{}, header http.Header) error {
+	return New(s).FillHeader(header)
+}
@@ -14,6 +14,12 @@ var (
 	DefaultTagName = "http" // struct's field default tag name
 )
 
+// Param is the value of a tagged field along with the options of its tag.
+type Param struct {
+	Value   interface{}
+	Options TagOptions
+}
+
 // Struct encapsulates a struct type to provide several high level functions
 // around the struct.
 type Struct struct {
@@ -76,6 +82,34 @@ func New(s interface{}) *Struct {
 //   // the field is skipped if empty.
 //   Field string `structs:",omitempty"`
 //
+// A tag value with the option of "body" collects the field into the "_body_"
+// key. A single struct, map, slice or pointer field is the body as is, while
+// several fields, or scalar ones, are merged into a map keyed by their names.
+// Example:
+//
+//   // The body is the RequestBody value.
+//   Body RequestBody `http:"body,body"`
+//
+//   // The body is map[string]interface{}{"name": ..., "age": ...}.
+//   Name string `http:"name,body"`
+//   Age  int    `http:"age,body"`
+//
+// A tag value with the option of "header", "query", "path" or "form" collects
+// the field as a Param into the "_header_", "_query_", "_path_" or "_form_"
+// key. The options following the name tell how to encode the value. Example:
+//
+//   // Sent as ?ids=1&ids=2, or ?ids=1,2 with the "csv" option.
+//   IDs []int `http:"ids,query,explode"`
+//
+// A tag value with the option of "authorizationType", "bearer", "basic" or
+// "apikey" collects the field as a Param into the "_auth_" key. Example:
+//
+//   // Sent as the "Authorization: Bearer <token>" header.
+//   AccessToken string `http:"access-token,bearer"`
+//
+//   // Sent as the "X-API-Key: <key>" header.
+//   Key string `http:"key,apikey=X-API-Key"`
+//
 // Note that only exported fields of a struct can be accessed, non exported
 // fields will be neglected.
 func (s *Struct) Map() map[string]interface{} {
@@ -92,6 +126,9 @@ func (s *Struct) FillMap(out map[string]interface{}) {
 		queryMap  map[string]interface{}
 		pathMap   map[string]interface{}
 		form      map[string]interface{}
+		bodyMap   map[string]interface{}
+		bodyField interface{}
+		authMap   map[string]interface{}
 	)
 	if out == nil {
 		return
@@ -141,7 +178,7 @@ func (s *Struct) FillMap(out map[string]interface{}) {
 			if headerMap == nil {
 				headerMap = make(map[string]interface{})
 			}
-			headerMap[name] = finalVal
+			headerMap[name] = Param{Value: val.Interface(), Options: tagOpts}
 			continue
 		}
 
@@ -149,7 +186,7 @@ func (s *Struct) FillMap(out map[string]interface{}) {
 			if queryMap == nil {
 				queryMap = make(map[string]interface{})
 			}
-			queryMap[name] = finalVal
+			queryMap[name] = Param{Value: val.Interface(), Options: tagOpts}
 			continue
 		}
 
@@ -157,7 +194,7 @@ func (s *Struct) FillMap(out map[string]interface{}) {
 			if pathMap == nil {
 				pathMap = make(map[string]interface{})
 			}
-			pathMap[name] = finalVal
+			pathMap[name] = Param{Value: val.Interface(), Options: tagOpts}
 			continue
 		}
 
@@ -165,14 +202,27 @@ func (s *Struct) FillMap(out map[string]interface{}) {
 			if form == nil {
 				form = make(map[string]interface{})
 			}
-			form[name] = finalVal
+			form[name] = Param{Value: val.Interface(), Options: tagOpts}
+			continue
+		}
+
+		if isAuth(tagOpts) {
+			if authMap == nil {
+				authMap = make(map[string]interface{})
+			}
+			authMap[name] = Param{Value: val.Interface(), Options: tagOpts}
 			continue
 		}
 
-		// if tagOpts.Has("body") {
-		// 	out["_body_"] = finalVal
-		// 	continue
-		// }
+		if tagOpts.Has("body") {
+			if bodyMap == nil {
+				bodyMap = make(map[string]interface{})
+			}
+			// keep the value as is so that it is encoded with its own tags
+			bodyMap[name] = val.Interface()
+			bodyField = val.Interface()
+			continue
+		}
 
 		if tagOpts.Has("string") {
 			s, ok := val.Interface().(fmt.Stringer)
@@ -202,6 +252,32 @@ func (s *Struct) FillMap(out map[string]interface{}) {
 	if form != nil {
 		out["_form_"] = form
 	}
+	if authMap != nil {
+		out["_auth_"] = authMap
+	}
+	if bodyMap != nil {
+		if len(bodyMap) == 1 && isComposite(bodyField) {
+			out["_body_"] = bodyField
+		} else {
+			out["_body_"] = bodyMap
+		}
+	}
+}
+
+// isAuth returns true if the tag options mark a credential.
+func isAuth(tagOpts TagOptions) bool {
+	_, apiKey := tagOpts.Value("apikey")
+	return apiKey || tagOpts.Has("authorizationType") || tagOpts.Has("bearer") || tagOpts.Has("basic")
+}
+
+// isComposite returns true if the given value is a struct, a map, a slice, an
+// array or a pointer.
+func isComposite(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		return true
+	}
+	return false
 }
 
 // Values converts the given s struct's field values to a []interface{}.  A
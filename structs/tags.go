@@ -2,11 +2,11 @@ package structs
 
 import "strings"
 
-// tagOptions contains a slice of tag options
-type tagOptions []string
+// TagOptions contains a slice of tag options
+type TagOptions []string
 
-// Has returns true if the given option is available in tagOptions
-func (t tagOptions) Has(opt string) bool {
+// Has returns true if the given option is available in TagOptions
+func (t TagOptions) Has(opt string) bool {
 	for _, tagOpt := range t {
 		if tagOpt == opt {
 			return true
@@ -16,10 +16,25 @@ func (t tagOptions) Has(opt string) bool {
 	return false
 }
 
+// Value returns the value of an option in the form of "key=value" and whether
+// the option is available. An option given without value returns "", true.
+func (t TagOptions) Value(key string) (string, bool) {
+	for _, tagOpt := range t {
+		if tagOpt == key {
+			return "", true
+		}
+		if strings.HasPrefix(tagOpt, key+"=") {
+			return tagOpt[len(key)+1:], true
+		}
+	}
+
+	return "", false
+}
+
 // parseTag splits a struct field's tag into its name and a list of options
 // which comes after a name. A tag is in the form of: "name,option1,option2".
 // The name can be neglectected.
-func parseTag(tag string) (string, tagOptions) {
+func parseTag(tag string) (string, TagOptions) {
 	// tag is one of followings:
 	// ""
 	// "name"
@@ -0,0 +1,197 @@
+package structs
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError describes a field that breaks one of the validation options of
+// its tag.
+type FieldError struct {
+	// Field is the path of the struct field, such as "Body.Name".
+	Field string
+	// Name is the name given by the tag, or the field name.
+	Name string
+	// Rule is the option that failed: required, min, max, pattern or enum.
+	Rule string
+	// Message tells why the value was rejected.
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+var patterns sync.Map // pattern -> *regexp.Regexp
+
+// Validate checks the fields of s against the validation options of their
+// tags and returns every failing field. Example:
+//
+//   // Must be set.
+//   UUID string `http:"uuid,path,required"`
+//
+//   // Between 1 and 100 for a number, or a length between 1 and 100 for a
+//   // string, a slice or a map.
+//   Limit int `http:"limit,query,min=1,max=100"`
+//
+//   // Must match the regular expression, which cannot contain a comma.
+//   Code string `http:"code,query,pattern=^[A-Z]{3}$"`
+//
+//   // Must be one of the values separated by "|".
+//   Status string `http:"status,query,enum=paid|unpaid"`
+//
+// A zero value fails the "required" option. The other options are not
+// checked for the zero values that are not sent: nil values and the zero
+// values of "omitempty" fields. Fields of embedded structs and struct fields tagged with
+// the "body" option are checked too.
+func (s *Struct) Validate() []FieldError {
+	return validate(s.value, s.TagName, "")
+}
+
+func validate(v reflect.Value, tagName, prefix string) []FieldError {
+	var errs []FieldError
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// we can't access the value of unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+
+		name, tagOpts := parseTag(tag)
+		if name == "" {
+			name = field.Name
+		}
+		path := prefix + field.Name
+		val := v.Field(i)
+
+		if val.IsZero() {
+			if tagOpts.Has("required") {
+				errs = append(errs, FieldError{Field: path, Name: name, Rule: "required", Message: "is required"})
+				continue
+			}
+			// the value is not sent
+			if tagOpts.Has("omitempty") || isNil(val) {
+				continue
+			}
+		}
+
+		for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+			val = val.Elem()
+		}
+
+		for _, rule := range []string{"min", "max", "pattern", "enum"} {
+			arg, ok := tagOpts.Value(rule)
+			if !ok {
+				continue
+			}
+			if msg := check(val, rule, arg); msg != "" {
+				errs = append(errs, FieldError{Field: path, Name: name, Rule: rule, Message: msg})
+			}
+		}
+
+		if val.Kind() == reflect.Struct && val.Type() != timeType && (tagOpts.Has("body") || (tag == "" && field.Anonymous)) {
+			errs = append(errs, validate(val, tagName, path+".")...)
+		}
+	}
+
+	return errs
+}
+
+// isNil reports whether val is a nil pointer, interface, slice or map.
+func isNil(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return val.IsNil()
+	}
+	return false
+}
+
+// check returns why val breaks the rule, or "" if it does not.
+func check(val reflect.Value, rule, arg string) string {
+	switch rule {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("invalid %s option %q", rule, arg)
+		}
+		n, length, ok := measure(val)
+		if !ok {
+			return fmt.Sprintf("%s option does not apply to %s", rule, val.Type())
+		}
+		switch {
+		case rule == "min" && n < limit && length:
+			return fmt.Sprintf("length must be at least %s", arg)
+		case rule == "min" && n < limit:
+			return fmt.Sprintf("must be at least %s", arg)
+		case rule == "max" && n > limit && length:
+			return fmt.Sprintf("length must be at most %s", arg)
+		case rule == "max" && n > limit:
+			return fmt.Sprintf("must be at most %s", arg)
+		}
+	case "pattern":
+		re, err := compilePattern(arg)
+		if err != nil {
+			return fmt.Sprintf("invalid pattern %q", arg)
+		}
+		if s := fmt.Sprint(val.Interface()); !re.MatchString(s) {
+			return fmt.Sprintf("%q does not match %s", s, arg)
+		}
+	case "enum":
+		s := fmt.Sprint(val.Interface())
+		for _, value := range strings.Split(arg, "|") {
+			if s == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not one of %s", s, strings.ReplaceAll(arg, "|", ", "))
+	}
+	return ""
+}
+
+// measure returns the number to compare with the min and max options: the
+// value of a number, or the length of a string, a slice or a map.
+func measure(val reflect.Value) (n float64, length bool, ok bool) {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), false, true
+	case reflect.String:
+		return float64(len([]rune(val.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(val.Len()), true, true
+	}
+	return 0, false, false
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// Validate checks the fields of s against the validation options of their
+// tags. For more info refer to Struct types Validate() method. It panics if
+// s's kind is not struct.
+func Validate(s interface{}) []FieldError {
+	return New(s).Validate()
+}
@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/phuc1998/http-builder/structs"
+)
+
+// Validator is implemented by request structs that check themselves. Validate is called
+// by the Build methods along with the required, min, max, pattern and enum tag options.
+// A ValidationError returned by Validate is merged with the errors of the tag options.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes a field of a request struct that failed validation.
+type FieldError = structs.FieldError
+
+// ValidationError lists every field of the request structs that failed validation.
+// It is returned by Call before the request is sent.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return fmt.Sprintf("validation failed: %s", strings.Join(messages, "; "))
+}
+
+// validate checks a request struct given to a Build method and records the failing fields.
+func (b *builder) validate(request interface{}) {
+	fields := structs.Validate(request)
+
+	if validator, ok := request.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				fields = append(fields, validationErr.Fields...)
+			} else {
+				fields = append(fields, FieldError{Field: structs.Name(request), Rule: "validate", Message: err.Error()})
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if !containsField(b.invalidFields, field) {
+			b.invalidFields = append(b.invalidFields, field)
+		}
+	}
+}
+
+// containsField returns true if the field error was already recorded, when the same
+// request struct is given to several Build methods.
+func containsField(fields []FieldError, field FieldError) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}